@@ -0,0 +1,681 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/places"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+// The browser is drawn with ANSI escapes on the alternate screen; the
+// terminal is switched to unbuffered input with stty, so it needs a Unix-like
+// terminal.
+const (
+	browseDetailLines = 9
+	browseRedraw      = 100 * time.Millisecond
+)
+
+type browseColumn struct {
+	title string
+	width int
+	cmp   func(a, b models.Trip) int
+}
+
+var browseColumns = []browseColumn{
+	{"Provider", 12, func(a, b models.Trip) int { return strings.Compare(a.Provider, b.Provider) }},
+	{"Dep", 11, func(a, b models.Trip) int { return compareTrips(a, b, "departure", weights) }},
+	{"Arr", 13, func(a, b models.Trip) int { return compareTrips(a, b, "arrival", weights) }},
+	{"Price", 11, func(a, b models.Trip) int { return compareTrips(a, b, "price", weights) }},
+	{"Dur", 8, func(a, b models.Trip) int { return compareTrips(a, b, "duration", weights) }},
+	{"Chg", 5, func(a, b models.Trip) int { return compareTrips(a, b, "transfers", weights) }},
+	{"Destination", 0, func(a, b models.Trip) int { return strings.Compare(a.DestinationPlace, b.DestinationPlace) }},
+}
+
+// browseRow is a trip or, when grouping, a destination header.
+type browseRow struct {
+	header string
+	trip   *models.Trip
+}
+
+type browser struct {
+	trips   []models.Trip
+	rows    []browseRow
+	visible int
+
+	sortCol int // -1 keeps the --sort order
+	desc    bool
+	grouped bool
+	filter  string
+	editing bool
+	detail  bool
+
+	cursor, offset int
+	height, width  int
+
+	queries, total int
+	done           bool
+	status         string
+}
+
+// browseSearch runs the search in the background and shows the trips kept
+// by keep in the browser as they come in. When the user quits it returns
+// every trip found so far, the kept ones and whether the search had finished.
+// It fails without searching when the terminal cannot be set up.
+func browseSearch(pairs []searchPair, dates []time.Time, reg *places.Registry, keep func([]models.Trip) []models.Trip) (found, kept []models.Trip, complete bool, err error) {
+	restore, err := enterRawMode()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer restore()
+
+	// Quitting closes stop: no further queries start and the ones still
+	// running hand their trips to nobody instead of blocking. The terminal
+	// is only restored once the key reader has let go of stdin, so it cannot
+	// swallow the answer to a later prompt.
+	stop := make(chan struct{})
+	keys := readKeys(stop)
+	defer func() {
+		close(stop)
+		for range keys {
+		}
+	}()
+	batches := make(chan []models.Trip, 64)
+	go func() {
+		streamPairs(pairs, dates, reg, stop, func(trips []models.Trip) {
+			select {
+			case batches <- trips:
+			case <-stop:
+			}
+		})
+		close(batches)
+	}()
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, sigWinch)
+	defer signal.Stop(resized)
+
+	b := &browser{sortCol: -1, total: len(pairs) * len(dates)}
+	b.height, b.width = terminalSize()
+	b.rebuild()
+	b.render()
+	tick := time.NewTicker(browseRedraw)
+	defer tick.Stop()
+	dirty := false
+
+	for {
+		select {
+		case trips, ok := <-batches:
+			if !ok {
+				b.done = true
+				batches = nil
+				dirty = true
+				continue
+			}
+			b.queries++
+			found = append(found, trips...)
+			b.trips = append(b.trips, keep(trips)...)
+			dirty = true
+		case <-tick.C:
+			if dirty {
+				b.rebuild()
+				b.render()
+				dirty = false
+			}
+		case <-resized:
+			b.height, b.width = terminalSize()
+			dirty = true
+		case k, ok := <-keys:
+			// Without input nobody can browse any longer.
+			if !ok || !b.handleKey(k) {
+				return found, b.trips, b.done, nil
+			}
+			b.rebuild()
+			b.render()
+			dirty = false
+		}
+	}
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// enterRawMode switches to unbuffered, silent input on the alternate screen
+// and returns the function that undoes it. Reads give up after a tenth of a
+// second without a key, so the key reader can notice when to stop.
+func enterRawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "-ixon", "min", "0", "time", "1"); err != nil {
+		return nil, err
+	}
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	return func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		stty(saved)
+	}, nil
+}
+
+// sigWinch is SIGWINCH, which tells of a resized terminal, on Linux, macOS
+// and the BSDs. The syscall package does not define it on Windows, where it
+// never arrives.
+const sigWinch = syscall.Signal(28)
+
+// terminalSize asks stty for the size of the terminal, falling back to 24x80.
+// The browser calls it once and again whenever SIGWINCH arrives.
+func terminalSize() (rows, cols int) {
+	out, err := stty("size")
+	if err == nil {
+		fmt.Sscan(out, &rows, &cols)
+	}
+	if rows < 10 || cols < 40 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// Keys other than single characters.
+const (
+	keyUp    = "up"
+	keyDown  = "down"
+	keyPgUp  = "pgup"
+	keyPgDn  = "pgdn"
+	keyHome  = "home"
+	keyEnd   = "end"
+	keyEnter = "enter"
+	keyEsc   = "esc"
+	keyBack  = "backspace"
+)
+
+var escapeKeys = map[string]string{
+	"\x1b[A": keyUp, "\x1b[B": keyDown, "\x1bOA": keyUp, "\x1bOB": keyDown,
+	"\x1b[5~": keyPgUp, "\x1b[6~": keyPgDn,
+	"\x1b[H": keyHome, "\x1b[F": keyEnd, "\x1b[1~": keyHome, "\x1b[4~": keyEnd,
+	"\x1bOH": keyHome, "\x1bOF": keyEnd,
+}
+
+// readKeys delivers key presses from stdin until stop is closed, then closes
+// the channel. Escape sequences arrive in a single read, so a lone ESC byte
+// is the Esc key.
+func readKeys(stop <-chan struct{}) <-chan string {
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		send := func(k string) bool {
+			select {
+			case keys <- k:
+				return true
+			case <-stop:
+				return false
+			}
+		}
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if n == 0 {
+				// A read that timed out without a key looks like EOF.
+				if err == nil || err == io.EOF {
+					continue
+				}
+				return
+			}
+			in := string(buf[:n])
+			for in != "" {
+				k := ""
+				if in[0] == 0x1b {
+					if len(in) == 1 {
+						k, in = keyEsc, ""
+					} else {
+						seq := in
+						if end := strings.IndexAny(in[2:], "ABCDHF~"); end >= 0 {
+							seq = in[:end+3]
+						}
+						k, in = escapeKeys[seq], in[len(seq):]
+					}
+				} else {
+					r, size := utf8.DecodeRuneInString(in)
+					in = in[size:]
+					switch r {
+					case '\r', '\n':
+						k = keyEnter
+					case 0x7f, 0x08:
+						k = keyBack
+					case 0x03:
+						k = "q"
+					default:
+						k = string(r)
+					}
+				}
+				if k != "" && !send(k) {
+					return
+				}
+			}
+		}
+	}()
+	return keys
+}
+
+// handleKey applies a key press and reports whether to keep browsing.
+func (b *browser) handleKey(k string) bool {
+	if b.editing {
+		switch k {
+		case keyEnter:
+			b.editing = false
+		case keyEsc:
+			b.editing, b.filter = false, ""
+		case keyBack:
+			if _, size := utf8.DecodeLastRuneInString(b.filter); size > 0 {
+				b.filter = b.filter[:len(b.filter)-size]
+			}
+		default:
+			if utf8.RuneCountInString(k) == 1 {
+				b.filter += k
+			}
+		}
+		b.cursor, b.offset = 0, 0
+		return true
+	}
+
+	page := max(b.listHeight()-1, 1)
+	b.status = ""
+	switch k {
+	case "q", keyEsc:
+		if k == keyEsc && b.filter != "" {
+			b.filter = ""
+			break
+		}
+		return false
+	case keyUp, "k":
+		b.cursor--
+	case keyDown, "j":
+		b.cursor++
+	case keyPgUp:
+		b.cursor -= page
+	case keyPgDn, " ":
+		b.cursor += page
+	case keyHome:
+		b.cursor = 0
+	case keyEnd:
+		b.cursor = len(b.rows) - 1
+	case "/":
+		b.editing = true
+	case "g":
+		b.grouped = !b.grouped
+		b.cursor, b.offset = 0, 0
+	case keyEnter, "d":
+		b.detail = !b.detail
+	case "o":
+		if t := b.selected(); t != nil && t.BookingURL != "" {
+			if err := openBrowser(t.BookingURL); err != nil {
+				b.status = "Could not open a browser: " + err.Error()
+			} else {
+				b.status = "Opened " + t.Provider + " booking page"
+			}
+		}
+	case "e":
+		b.export()
+	case "0":
+		b.sortCol, b.desc = -1, false
+	default:
+		if n, err := strconv.Atoi(k); err == nil && n >= 1 && n <= len(browseColumns) {
+			if b.sortCol == n-1 {
+				b.desc = !b.desc
+			} else {
+				b.sortCol, b.desc = n-1, false
+			}
+		}
+	}
+	return true
+}
+
+func (b *browser) selected() *models.Trip {
+	if b.cursor < 0 || b.cursor >= len(b.rows) {
+		return nil
+	}
+	return b.rows[b.cursor].trip
+}
+
+// viewTrips returns the trips that pass the filter, in display order.
+func (b *browser) viewTrips() []models.Trip {
+	terms := strings.Fields(b.filter)
+	var view []models.Trip
+	for _, t := range b.trips {
+		if matchesFilter(t, terms) {
+			view = append(view, t)
+		}
+	}
+	if paretoFlag {
+		view = paretoFront(view)
+	}
+	if b.sortCol < 0 {
+		sortTrips(view, sortBy, weights)
+	} else {
+		col := browseColumns[b.sortCol]
+		sort.SliceStable(view, func(i, j int) bool {
+			c := col.cmp(view[i], view[j])
+			if b.desc {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+	return view
+}
+
+// matchesFilter checks every filter term: p:name for the provider, d:name
+// for the destination, <N and >N for the price, 8-12 for the departure hour
+// and any other word for provider, stations or places.
+func matchesFilter(t models.Trip, terms []string) bool {
+	contains := func(s, sub string) bool {
+		return strings.Contains(utils.NormalizeName(s), utils.NormalizeName(sub))
+	}
+	for _, term := range terms {
+		switch {
+		case strings.HasPrefix(term, "p:"):
+			if !contains(t.Provider, term[2:]) {
+				return false
+			}
+		case strings.HasPrefix(term, "d:"):
+			if !contains(t.DestinationPlace, term[2:]) && !contains(t.DestinationStation, term[2:]) {
+				return false
+			}
+		case strings.HasPrefix(term, "<") || strings.HasPrefix(term, ">"):
+			limit, err := strconv.ParseFloat(term[1:], 64)
+			if err != nil {
+				continue
+			}
+			if term[0] == '<' && t.Price > limit || term[0] == '>' && t.Price < limit {
+				return false
+			}
+		default:
+			if from, to, ok := strings.Cut(term, "-"); ok {
+				h1, err1 := strconv.Atoi(from)
+				h2, err2 := strconv.Atoi(to)
+				if err1 == nil && err2 == nil {
+					h := displayTime(t.DepartureTime).Hour()
+					if h < h1 || h >= h2 {
+						return false
+					}
+					continue
+				}
+			}
+			if !contains(t.Provider, term) && !contains(t.OriginStation, term) && !contains(t.DestinationStation, term) &&
+				!contains(t.OriginPlace, term) && !contains(t.DestinationPlace, term) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rebuild recomputes the rows, keeping the cursor on the same trip.
+func (b *browser) rebuild() {
+	var current *models.Trip
+	if t := b.selected(); t != nil {
+		c := *t
+		current = &c
+	}
+
+	view := b.viewTrips()
+	b.visible = len(view)
+	b.rows = b.rows[:0]
+	if b.grouped {
+		var order []string
+		byPlace := make(map[string][]int)
+		for i, t := range view {
+			if byPlace[t.DestinationPlace] == nil {
+				order = append(order, t.DestinationPlace)
+			}
+			byPlace[t.DestinationPlace] = append(byPlace[t.DestinationPlace], i)
+		}
+		for _, place := range order {
+			idx := byPlace[place]
+			cheapest := view[idx[0]]
+			for _, i := range idx {
+				if view[i].Price < cheapest.Price {
+					cheapest = view[i]
+				}
+			}
+			b.rows = append(b.rows, browseRow{header: fmt.Sprintf("%s: %d trips, from %.2f%s", place, len(idx), cheapest.Price, cheapest.Currency)})
+			for _, i := range idx {
+				b.rows = append(b.rows, browseRow{trip: &view[i]})
+			}
+		}
+	} else {
+		for i := range view {
+			b.rows = append(b.rows, browseRow{trip: &view[i]})
+		}
+	}
+
+	if current != nil {
+		for i, r := range b.rows {
+			if r.trip != nil && sameTrip(*r.trip, *current) {
+				b.cursor = i
+				break
+			}
+		}
+	}
+	b.cursor = max(min(b.cursor, len(b.rows)-1), 0)
+	h := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+h {
+		b.offset = b.cursor - h + 1
+	}
+}
+
+func sameTrip(a, b models.Trip) bool {
+	return a.Provider == b.Provider && a.DepartureTime.Equal(b.DepartureTime) &&
+		a.OriginStation == b.OriginStation && a.DestinationStation == b.DestinationStation && a.Price == b.Price
+}
+
+// listHeight is the number of rows left for trips after the status, header,
+// detail pane and help lines.
+func (b *browser) listHeight() int {
+	h := b.height - 3
+	if b.detail {
+		h -= browseDetailLines + 1
+	}
+	return max(h, 1)
+}
+
+// fit pads or cuts s to exactly w runes.
+func fit(s string, w int) string {
+	n := utf8.RuneCountInString(s)
+	if n > w {
+		r := []rune(s)
+		if w > 1 {
+			return string(r[:w-1]) + "…"
+		}
+		return string(r[:w])
+	}
+	return s + strings.Repeat(" ", w-n)
+}
+
+func (b *browser) tripLine(t models.Trip) string {
+	dep, arr := formatTimes(t)
+	cells := []string{
+		fit(t.Provider, browseColumns[0].width),
+		fit(dep, browseColumns[1].width),
+		fit(arr, browseColumns[2].width),
+		fit(fmt.Sprintf("%8.2f%s", t.Price, t.Currency), browseColumns[3].width),
+		fit(formatDuration(tripDuration(t)), browseColumns[4].width),
+		fit(strconv.Itoa(t.Transfers), browseColumns[5].width),
+		t.OriginStation + " -> " + t.DestinationStation,
+	}
+	return strings.Join(cells, " ")
+}
+
+func (b *browser) headerLine() string {
+	cells := make([]string, len(browseColumns))
+	for i, c := range browseColumns {
+		title := fmt.Sprintf("%d %s", i+1, c.title)
+		if i == b.sortCol {
+			if b.desc {
+				title += " v"
+			} else {
+				title += " ^"
+			}
+		}
+		if c.width > 0 {
+			title = fit(title, c.width)
+		}
+		cells[i] = title
+	}
+	return strings.Join(cells, " ")
+}
+
+func (b *browser) render() {
+	var sb strings.Builder
+	line := func(s string, style string) {
+		s = fit(s, b.width)
+		if style != "" {
+			s = style + s + "\x1b[0m"
+		}
+		sb.WriteString(s + "\x1b[K\r\n")
+	}
+	sb.WriteString("\x1b[H")
+
+	progress := fmt.Sprintf("searching %d/%d", b.queries, b.total)
+	if b.done {
+		progress = "search done"
+	}
+	order := "sort: " + strings.Join(sortBy, ",")
+	if b.sortCol >= 0 {
+		order = "sort: " + strings.ToLower(browseColumns[b.sortCol].title)
+	}
+	status := fmt.Sprintf("%d trips, %d shown | %s | %s", len(b.trips), b.visible, progress, order)
+	if b.grouped {
+		status += " | by destination"
+	}
+	if b.filter != "" {
+		status += " | filter: " + b.filter
+	}
+	line(status, "\x1b[1m")
+	line(b.headerLine(), "\x1b[4m")
+
+	h := b.listHeight()
+	for i := b.offset; i < b.offset+h; i++ {
+		if i >= len(b.rows) {
+			line("", "")
+			continue
+		}
+		r := b.rows[i]
+		text, style := "", ""
+		if r.trip != nil {
+			text = b.tripLine(*r.trip)
+			if b.grouped {
+				text = "  " + text
+			}
+		} else {
+			text, style = r.header, "\x1b[1m"
+		}
+		if i == b.cursor {
+			style = "\x1b[7m"
+		}
+		line(text, style)
+	}
+
+	if b.detail {
+		line(strings.Repeat("─", b.width), "")
+		details := b.detailLines()
+		for i := 0; i < browseDetailLines; i++ {
+			if i < len(details) {
+				line(details[i], "")
+			} else {
+				line("", "")
+			}
+		}
+	}
+
+	switch {
+	case b.editing:
+		sb.WriteString(fit("/"+b.filter+"▏  (p:provider d:destination <price >price 8-12 hours, enter done, esc clear)", b.width) + "\x1b[K")
+	case b.status != "":
+		sb.WriteString(fit(b.status, b.width) + "\x1b[K")
+	default:
+		sb.WriteString(fit("up/down move  1-7 sort  0 reset  / filter  g group  enter details  o open  e export  q quit", b.width) + "\x1b[K")
+	}
+	fmt.Print(sb.String())
+}
+
+func (b *browser) detailLines() []string {
+	t := b.selected()
+	if t == nil {
+		return []string{"Select a trip to see its details."}
+	}
+	dep, arr := formatTimes(*t)
+	lines := []string{
+		fmt.Sprintf("%s  %s -> %s  (%s -> %s)", t.Provider, t.OriginStation, t.DestinationStation, t.OriginPlace, t.DestinationPlace),
+		fmt.Sprintf("%s -> %s, %s, %d transfers, %s", dep, arr, formatDuration(tripDuration(*t)), t.Transfers, t.VehicleType),
+	}
+	price := fmt.Sprintf("%.2f%s", t.Price, t.Currency)
+	if partySize() > 1 {
+		price += fmt.Sprintf(" (%.2f per person)", t.Price/float64(partySize()))
+	}
+	if t.OriginalCurrency != "" {
+		price += fmt.Sprintf(", was %.2f%s", t.OriginalPrice, t.OriginalCurrency)
+	}
+	lines = append(lines, fmt.Sprintf("Price %s, seats %s", price, seatsCell(t.Seats, t.SeatsKnown)))
+	var tail []string
+	if len(t.Fares) > 0 {
+		tail = append(tail, "Classes: "+faresCell(t.Fares, " | "))
+	}
+	if len(t.Amenities) > 0 {
+		tail = append(tail, "On board: "+strings.Join(t.Amenities, ", "))
+	}
+	if t.BookingURL != "" {
+		tail = append(tail, "Book: "+t.BookingURL)
+	}
+	// Long journeys give up segments rather than the lines after them, so the
+	// booking link always shows.
+	segs := t.Segments
+	room := browseDetailLines - len(lines) - len(tail)
+	if len(segs) > room {
+		segs = segs[:max(room-1, 0)]
+	}
+	for _, s := range segs {
+		lines = append(lines, fmt.Sprintf("  %s %s -> %s %s  %s",
+			displayTime(s.DepartureTime).Format("15:04"), s.OriginStation,
+			displayTime(s.ArrivalTime).Format("15:04"), s.DestinationStation, s.VehicleType))
+	}
+	if hidden := len(t.Segments) - len(segs); hidden > 0 {
+		lines = append(lines, fmt.Sprintf("  ... %d more segments", hidden))
+	}
+	return append(lines, tail...)
+}
+
+// export saves the trips of the current view, filtered and sorted, as CSV.
+func (b *browser) export() {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, "trips")
+	os.MkdirAll(dir, 0755)
+	path := filepath.Join(dir, fmt.Sprintf("view_%s.csv", time.Now().Format("20060102_150405")))
+	if err := saveCSV(path, b.viewTrips()); err != nil {
+		b.status = "Export failed: " + err.Error()
+		return
+	}
+	b.status = fmt.Sprintf("Exported %d trips to %s", b.visible, path)
+}
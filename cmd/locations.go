@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+var locationsCmd = &cobra.Command{
+	Use:   "locations <query>",
+	Short: "List location candidates per provider",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetDebug(debugFlag)
+		runLocations(strings.Join(args, " "))
+	},
+}
+
+func init() {
+	locationsCmd.Flags().StringVarP(&provArg, "provider", "p", "all", "Provider (all, flixbus, regiojet, db, blablacar), comma separated")
+	locationsCmd.Flags().BoolVarP(&debugFlag, "debug", "v", false, "Enable debug logs")
+	rootCmd.AddCommand(locationsCmd)
+}
+
+func runLocations(query string) {
+	pList := selectProviders(provArg)
+	if len(pList) == 0 {
+		fmt.Printf("Unknown provider: %s\n", provArg)
+		os.Exit(1)
+	}
+
+	for _, p := range pList {
+		fmt.Printf("\n--- %s ---\n", p.Name())
+		cands, err := p.SearchLocationCandidates(query)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		if len(cands) == 0 {
+			fmt.Println("No candidates.")
+			continue
+		}
+		fmt.Printf("%-3s | %-30s | %-7s | %-2s | %-19s | %-5s | %s\n", "#", "Name", "Type", "CC", "Coordinates", "Score", "ID")
+		for i, c := range cands {
+			fmt.Printf("%-3d | %-30s | %-7s | %-2s | %8.4f, %8.4f | %5.2f | %s\n",
+				i+1, c.Name, c.Type, c.Country, c.Latitude, c.Longitude, c.Score, c.ID)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/places"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+var rankArg string
+
+var meetCmd = &cobra.Command{
+	Use:   "meet",
+	Short: "Find destinations every origin can reach, ranked for a group meetup",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetDebug(debugFlag)
+		setupGeocoder()
+		setupRates()
+		setupPassengers()
+		runMeet()
+	},
+}
+
+func init() {
+	meetCmd.Flags().StringVarP(&fromArg, "from", "f", "", "Origins, comma separated (cities or lat,lon)")
+	meetCmd.Flags().StringVarP(&dateArg, "date", "d", "tomorrow", "Date (YYYY-MM-DD, today, tomorrow, fri)")
+	meetCmd.Flags().StringVarP(&rankArg, "rank", "r", "total-fare", "Rank by: total-fare, max-fare, total-time, max-time, spread")
+	addSearchFlags(meetCmd)
+	meetCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(meetCmd)
+}
+
+// Candidates are searched around the centroid of the origins, in a circle a
+// little wider than the one through the furthest origin, and capped per
+// provider to the ones closest to the centroid.
+const (
+	meetRadiusFactor  = 1.25
+	meetMinRadiusKm   = 100.0
+	meetMaxCandidates = 40
+	meetShown         = 15
+	meetDetailed      = 5
+)
+
+var meetRanks = map[string]bool{
+	"total-fare": true, "max-fare": true, "total-time": true, "max-time": true, "spread": true,
+}
+
+// meetOption is one destination with the trip chosen for each origin. A zero
+// Trip means that origin is already there.
+type meetOption struct {
+	Place     string
+	Legs      []models.Trip
+	TotalFare float64
+	MaxFare   float64
+	TotalTime time.Duration
+	MaxTime   time.Duration
+	Spread    time.Duration
+}
+
+func runMeet() {
+	if !meetRanks[rankArg] {
+		fmt.Printf("Unknown --rank %s\n", rankArg)
+		os.Exit(1)
+	}
+	origins := splitList(fromArg)
+	if len(origins) < 2 {
+		fmt.Println("Error: meet needs at least two origins")
+		os.Exit(1)
+	}
+	dates, err := utils.ParseDates(dateArg)
+	if err != nil {
+		fmt.Printf("Date error: %v\n", err)
+		os.Exit(1)
+	}
+	pList := selectProviders(provArg)
+	if len(pList) == 0 {
+		fmt.Printf("Unknown provider: %s\n", provArg)
+		os.Exit(1)
+	}
+
+	reg := places.NewRegistry(langArg)
+	res := newResolver(reg)
+	originMatches := make(placeMatches)
+
+	// groupOf maps each origin's canonical place to its index in origins.
+	groupOf := make(map[string]int)
+	fromByProvider := make(map[string][][]models.Location)
+	points := make([][2]float64, len(origins))
+	located := make([]bool, len(origins))
+	for _, p := range pList {
+		byGroup := make([][]models.Location, len(origins))
+		for g, q := range origins {
+			locs := uniqueLocations(resolveNames(p, "Origin", []string{q}, res, originMatches), "")
+			for _, l := range locs {
+				groupOf[reg.Add(p.Name(), l).Name] = g
+				if !located[g] {
+					if lat, lon, err := res.center(p, l); err == nil {
+						points[g], located[g] = [2]float64{lat, lon}, true
+					}
+				}
+			}
+			byGroup[g] = locs
+		}
+		fromByProvider[p.Name()] = byGroup
+	}
+	reportMismatches("Origin", originMatches)
+
+	for g, ok := range located {
+		if !ok {
+			fmt.Printf("Error: could not locate origin %s\n", origins[g])
+			os.Exit(1)
+		}
+	}
+	clat, clon, radius := meetCircle(points)
+	fmt.Printf("\nSearching destinations within %.0fkm of %.4f,%.4f...\n", radius, clat, clon)
+
+	var pairs []searchPair
+	for _, p := range pList {
+		cands, err := p.SearchLocationsByDistance(clat, clon, 0, radius)
+		if err != nil {
+			utils.DebugLog("%s: distance search error: %v", p.Name(), err)
+			continue
+		}
+		sort.Slice(cands, func(i, j int) bool { return cands[i].Distance < cands[j].Distance })
+		if len(cands) > meetMaxCandidates {
+			cands = cands[:meetMaxCandidates]
+		}
+		for _, c := range cands {
+			reg.Add(p.Name(), c)
+		}
+		for _, froms := range fromByProvider[p.Name()] {
+			for _, from := range froms {
+				for _, c := range uniqueLocations(cands, from.ID) {
+					pairs = append(pairs, searchPair{Provider: p, From: from, To: c})
+				}
+			}
+		}
+	}
+	fmt.Printf("Searching %d origin/destination pairs on %d dates...\n", len(pairs), len(dates))
+
+	// byDest[place][group] holds every trip from that origin to the place.
+	byDest := make(map[string][][]models.Trip)
+	for _, t := range searchPairs(pairs, dates, reg) {
+		g, ok := groupOf[t.OriginPlace]
+		if !ok || t.DestinationPlace == t.OriginPlace {
+			continue
+		}
+		if byDest[t.DestinationPlace] == nil {
+			byDest[t.DestinationPlace] = make([][]models.Trip, len(origins))
+		}
+		byDest[t.DestinationPlace][g] = append(byDest[t.DestinationPlace][g], t)
+	}
+
+	var options []meetOption
+	for place, trips := range byDest {
+		home, isHome := groupOf[place]
+		if opt, ok := chooseLegs(place, trips, home, isHome); ok {
+			options = append(options, opt)
+		}
+	}
+	if len(options) == 0 {
+		fmt.Println("\nNo destination is reachable from every origin.")
+		return
+	}
+	sort.Slice(options, func(i, j int) bool { return meetLess(options[i], options[j]) })
+	printMeet(origins, options)
+}
+
+// meetCircle returns the centroid of the origins and the search radius
+// around it.
+func meetCircle(points [][2]float64) (lat, lon, radius float64) {
+	for _, pt := range points {
+		lat += pt[0]
+		lon += pt[1]
+	}
+	lat /= float64(len(points))
+	lon /= float64(len(points))
+	for _, pt := range points {
+		radius = math.Max(radius, utils.HaversineDistance(lat, lon, pt[0], pt[1]))
+	}
+	return lat, lon, math.Max(radius*meetRadiusFactor, meetMinRadiusKm)
+}
+
+// chooseLegs picks one trip per origin according to --rank and computes the
+// option's scores. It fails when some origin cannot reach the place.
+func chooseLegs(place string, trips [][]models.Trip, home int, isHome bool) (meetOption, bool) {
+	opt := meetOption{Place: place, Legs: make([]models.Trip, len(trips))}
+	for g, ts := range trips {
+		if len(ts) == 0 && !(isHome && g == home) {
+			return opt, false
+		}
+	}
+
+	if rankArg == "spread" {
+		narrowestArrivals(trips, home, isHome, opt.Legs)
+	} else {
+		for g, ts := range trips {
+			if isHome && g == home {
+				continue
+			}
+			best := ts[0]
+			for _, t := range ts[1:] {
+				if rankArg == "total-fare" || rankArg == "max-fare" {
+					if t.Price < best.Price {
+						best = t
+					}
+				} else if tripDuration(t) < tripDuration(best) {
+					best = t
+				}
+			}
+			opt.Legs[g] = best
+		}
+	}
+
+	var first, last time.Time
+	for g, t := range opt.Legs {
+		if isHome && g == home {
+			continue
+		}
+		d := tripDuration(t)
+		opt.TotalFare += t.Price
+		opt.MaxFare = math.Max(opt.MaxFare, t.Price)
+		opt.TotalTime += d
+		if d > opt.MaxTime {
+			opt.MaxTime = d
+		}
+		if first.IsZero() || t.ArrivalTime.Before(first) {
+			first = t.ArrivalTime
+		}
+		if t.ArrivalTime.After(last) {
+			last = t.ArrivalTime
+		}
+	}
+	opt.Spread = last.Sub(first)
+	return opt, true
+}
+
+// narrowestArrivals fills legs with the trips whose arrivals lie in the
+// shortest window that still contains one trip from every travelling origin,
+// taking the cheapest trip of each origin inside that window.
+func narrowestArrivals(trips [][]models.Trip, home int, isHome bool, legs []models.Trip) {
+	type arrival struct {
+		group int
+		trip  models.Trip
+	}
+	var all []arrival
+	need := 0
+	for g, ts := range trips {
+		if isHome && g == home {
+			continue
+		}
+		need++
+		for _, t := range ts {
+			all = append(all, arrival{g, t})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].trip.ArrivalTime.Before(all[j].trip.ArrivalTime) })
+
+	count := make(map[int]int)
+	bestLo, bestHi := 0, len(all)-1
+	lo := 0
+	for hi := range all {
+		count[all[hi].group]++
+		for len(count) == need {
+			if all[hi].trip.ArrivalTime.Sub(all[lo].trip.ArrivalTime) < all[bestHi].trip.ArrivalTime.Sub(all[bestLo].trip.ArrivalTime) {
+				bestLo, bestHi = lo, hi
+			}
+			if count[all[lo].group]--; count[all[lo].group] == 0 {
+				delete(count, all[lo].group)
+			}
+			lo++
+		}
+	}
+
+	chosen := make(map[int]bool)
+	for _, a := range all[bestLo : bestHi+1] {
+		if !chosen[a.group] || a.trip.Price < legs[a.group].Price {
+			legs[a.group] = a.trip
+			chosen[a.group] = true
+		}
+	}
+}
+
+func meetLess(a, b meetOption) bool {
+	switch rankArg {
+	case "max-fare":
+		if a.MaxFare != b.MaxFare {
+			return a.MaxFare < b.MaxFare
+		}
+	case "total-time":
+		if a.TotalTime != b.TotalTime {
+			return a.TotalTime < b.TotalTime
+		}
+	case "max-time":
+		if a.MaxTime != b.MaxTime {
+			return a.MaxTime < b.MaxTime
+		}
+	case "spread":
+		if a.Spread != b.Spread {
+			return a.Spread < b.Spread
+		}
+	}
+	return a.TotalFare < b.TotalFare
+}
+
+func printMeet(origins []string, options []meetOption) {
+	fmt.Printf("\n--- %d destinations reachable from all %d origins (by %s) ---\n", len(options), len(origins), rankArg)
+	fmt.Printf("%-3s | %-25s | %-9s | %-9s | %-8s | %-8s | %s\n", "#", "Destination", "Total", "Max", "Tot time", "Max time", "Spread")
+	for i, o := range options {
+		if i == meetShown {
+			break
+		}
+		fmt.Printf("%-3d | %-25s | %9.2f | %9.2f | %-8s | %-8s | %s\n",
+			i+1, o.Place, o.TotalFare, o.MaxFare,
+			formatDuration(o.TotalTime), formatDuration(o.MaxTime), formatDuration(o.Spread))
+	}
+
+	for i, o := range options {
+		if i == meetDetailed {
+			break
+		}
+		fmt.Printf("\n%d. %s\n", i+1, o.Place)
+		for g, t := range o.Legs {
+			if t.Provider == "" {
+				fmt.Printf("  %-20s already there\n", origins[g])
+				continue
+			}
+			fmt.Printf("  %-20s %s -> %s  %-10s %6.2f%s  %s -> %s\n",
+				origins[g],
+				t.DepartureTime.Format("02.01 15:04"), t.ArrivalTime.Format("02.01 15:04"),
+				t.Provider, t.Price, t.Currency, t.OriginStation, t.DestinationStation)
+		}
+	}
+}
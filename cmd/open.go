@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/yuriiter/trips/pkg/models"
+)
+
+var openCmd = &cobra.Command{
+	Use:   "open <n>",
+	Short: "Open the booking page of the n-th result of the last search",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runOpen(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(openCmd)
+}
+
+// lastResultsPath is where every search keeps its results, in the order
+// shown, for trips open.
+func lastResultsPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "trips", "last.json")
+}
+
+func saveLastResults(trips []models.Trip) error {
+	path := lastResultsPath()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	return saveJSON(path, trips)
+}
+
+func runOpen(arg string) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		fmt.Printf("Error: expected a result number, got %q\n", arg)
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(lastResultsPath())
+	if err != nil {
+		fmt.Println("Error: no previous search results, run a search first")
+		os.Exit(1)
+	}
+	var trips []models.Trip
+	if err := json.Unmarshal(data, &trips); err != nil {
+		fmt.Printf("Error: reading %s: %v\n", lastResultsPath(), err)
+		os.Exit(1)
+	}
+	if n > len(trips) {
+		fmt.Printf("Error: the last search has %d results\n", len(trips))
+		os.Exit(1)
+	}
+
+	t := trips[n-1]
+	if t.BookingURL == "" {
+		fmt.Printf("Error: no booking link for result %d (%s)\n", n, t.Provider)
+		os.Exit(1)
+	}
+	fmt.Printf("%s %s -> %s, %s %.2f%s\n%s\n",
+		t.Provider, t.OriginStation, t.DestinationStation,
+		t.DepartureTime.Format("02.01 15:04"), t.Price, t.Currency, t.BookingURL)
+	if err := openBrowser(t.BookingURL); err != nil {
+		fmt.Printf("Could not open a browser: %v\n", err)
+	}
+}
+
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuriiter/trips/pkg/models"
+)
+
+var (
+	paretoFlag  bool
+	paretoRoute bool
+	weightsArg  string
+	sortBy      []string
+	weights     = defaultWeights
+)
+
+// Night departures, from nightStart until nightEnd local time, get the night
+// penalty in the weighted score.
+const (
+	nightStart = 23
+	nightEnd   = 5
+)
+
+var sortKeys = map[string]bool{
+	"price": true, "departure": true, "arrival": true, "duration": true, "transfers": true, "score": true,
+}
+
+// scoreWeights turns a trip into a single number, lower is better: price
+// counts per currency unit, duration per hour, transfers per change and night
+// once for departing at night.
+type scoreWeights struct {
+	Price, Hour, Transfer, Night float64
+}
+
+var defaultWeights = scoreWeights{Price: 1, Hour: 5, Transfer: 10, Night: 15}
+
+func sortsByScore() bool {
+	for _, k := range sortBy {
+		if k == "score" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSortKeys splits --sort into its keys, e.g. "price,departure".
+func parseSortKeys(arg string) ([]string, error) {
+	var keys []string
+	for _, k := range strings.Split(strings.ToLower(arg), ",") {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if !sortKeys[k] {
+			return nil, fmt.Errorf("unknown sort key %q (price, departure, arrival, duration, transfers, score)", k)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("--sort is empty")
+	}
+	return keys, nil
+}
+
+// parseWeights reads --weights such as "price=1,hour=5,transfer=10,night=15".
+// Weights left out keep their default.
+func parseWeights(arg string) (scoreWeights, error) {
+	w := defaultWeights
+	for _, part := range strings.Split(arg, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(part, "=")
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if !ok || err != nil || f < 0 {
+			return w, fmt.Errorf("invalid weight %q, expected e.g. hour=5", part)
+		}
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "price":
+			w.Price = f
+		case "hour", "hours", "duration":
+			w.Hour = f
+		case "transfer", "transfers":
+			w.Transfer = f
+		case "night":
+			w.Night = f
+		default:
+			return w, fmt.Errorf("unknown weight %q (price, hour, transfer, night)", name)
+		}
+	}
+	return w, nil
+}
+
+func departsAtNight(t models.Trip) bool {
+	h := t.DepartureTime.Hour()
+	return h >= nightStart || h < nightEnd
+}
+
+func (w scoreWeights) score(t models.Trip) float64 {
+	s := w.Price*t.Price + w.Hour*tripDuration(t).Hours() + w.Transfer*float64(t.Transfers)
+	if departsAtNight(t) {
+		s += w.Night
+	}
+	return s
+}
+
+// compareTrips orders two trips by a single sort key.
+func compareTrips(a, b models.Trip, key string, w scoreWeights) int {
+	cmp := func(x, y float64) int {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	switch key {
+	case "departure":
+		return a.DepartureTime.Compare(b.DepartureTime)
+	case "arrival":
+		return a.ArrivalTime.Compare(b.ArrivalTime)
+	case "duration":
+		return cmp(float64(tripDuration(a)), float64(tripDuration(b)))
+	case "transfers":
+		return a.Transfers - b.Transfers
+	case "score":
+		return cmp(w.score(a), w.score(b))
+	}
+	return cmp(a.Price, b.Price)
+}
+
+// sortTrips sorts by each key in turn, the later ones breaking ties.
+func sortTrips(trips []models.Trip, keys []string, w scoreWeights) {
+	sort.SliceStable(trips, func(i, j int) bool {
+		for _, k := range keys {
+			if c := compareTrips(trips[i], trips[j], k, w); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// dominates reports whether a is at least as good as b on price, duration and
+// transfers and better on at least one of them.
+func dominates(a, b models.Trip) bool {
+	da, db := tripDuration(a), tripDuration(b)
+	if a.Price > b.Price || da > db || a.Transfers > b.Transfers {
+		return false
+	}
+	return a.Price < b.Price || da < db || a.Transfers < b.Transfers
+}
+
+// paretoFront keeps the trips no other trip dominates. With --pareto-by-route
+// a trip is only compared with the others between the same origin and
+// destination place, so every route keeps its own front.
+func paretoFront(trips []models.Trip) []models.Trip {
+	byRoute := make(map[string][]int)
+	for i, t := range trips {
+		key := ""
+		if paretoRoute {
+			key = t.OriginPlace + "\x00" + t.DestinationPlace
+		}
+		byRoute[key] = append(byRoute[key], i)
+	}
+
+	keep := make([]bool, len(trips))
+	for _, idx := range byRoute {
+		for _, i := range idx {
+			keep[i] = true
+			for _, j := range idx {
+				if dominates(trips[j], trips[i]) {
+					keep[i] = false
+					break
+				}
+			}
+		}
+	}
+
+	front := make([]models.Trip, 0, len(trips))
+	for i, t := range trips {
+		if keep[i] {
+			front = append(front, t)
+		}
+	}
+	return front
+}
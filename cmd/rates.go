@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+var importArg string
+
+var ratesCmd = &cobra.Command{
+	Use:   "rates",
+	Short: "Show or update the exchange rates used to convert prices",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetDebug(debugFlag)
+		setupRates()
+		runRates()
+	},
+}
+
+func init() {
+	ratesCmd.Flags().StringVar(&importArg, "import", "", "Install a rate file as ~/trips/rates.json")
+	ratesCmd.Flags().BoolVarP(&debugFlag, "debug", "v", false, "Enable debug logs")
+	rootCmd.AddCommand(ratesCmd)
+}
+
+func runRates() {
+	if importArg != "" {
+		t, err := utils.ReadRates(importArg)
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", importArg, err)
+			os.Exit(1)
+		}
+		data, _ := os.ReadFile(importArg)
+		home, _ := os.UserHomeDir()
+		dir := filepath.Join(home, "trips")
+		os.MkdirAll(dir, 0755)
+		dest := filepath.Join(dir, "rates.json")
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			fmt.Printf("Error saving file: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Installed rates of %s to %s\n", t.Date, dest)
+		utils.LoadRates(dest)
+	}
+
+	t := utils.Rates()
+	fmt.Printf("Rates of %s (%s), per 1 %s:\n", t.Date, t.Source, t.Base)
+	codes := make([]string, 0, len(t.Rates))
+	for code := range t.Rates {
+		if code != t.Base {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Printf("  %s %10.4f\n", code, t.Rates[code])
+	}
+}
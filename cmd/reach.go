@@ -0,0 +1,419 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/places"
+	"github.com/yuriiter/trips/pkg/providers"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+var withinArg string
+
+var reachCmd = &cobra.Command{
+	Use:   "reach",
+	Short: "Find every place reachable within a travel time, with at most one change",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetDebug(debugFlag)
+		setupGeocoder()
+		setupRates()
+		setupPassengers()
+		runReach()
+	},
+}
+
+func init() {
+	reachCmd.Flags().StringVarP(&fromArg, "from", "f", "", "Origin city or lat,lon")
+	reachCmd.Flags().StringVarP(&withinArg, "within", "w", "4h", "Travel time budget, e.g. 3h or 4h30m")
+	reachCmd.Flags().StringVarP(&dateArg, "date", "d", "tomorrow", "Date (YYYY-MM-DD, today, tomorrow, fri)")
+	reachCmd.Flags().StringVarP(&outArg, "out", "o", "", "Output file path (GeoJSON)")
+	addSearchFlags(reachCmd)
+	reachCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(reachCmd)
+}
+
+// The search radius grows ring by ring. The first ring assumes a slow
+// regional connection, the last one a high-speed train; in between it keeps
+// growing while the outermost ring still has places within the budget.
+const (
+	reachMaxTransfers = 1
+	reachStartKmh     = 40.0
+	reachMaxKmh       = 160.0
+	reachGrowth       = 1.5
+)
+
+// reachResult is the best way to get to one canonical place.
+type reachResult struct {
+	Place    string
+	Distance float64
+	Fastest  models.Trip
+	Cheapest models.Trip
+}
+
+func tripDuration(t models.Trip) time.Duration {
+	return t.ArrivalTime.Sub(t.DepartureTime)
+}
+
+func (r *reachResult) add(t models.Trip) {
+	if t.Distance > 0 {
+		r.Distance = t.Distance
+	}
+	if r.Fastest.Provider == "" || tripDuration(t) < tripDuration(r.Fastest) ||
+		tripDuration(t) == tripDuration(r.Fastest) && t.ArrivalTime.Before(r.Fastest.ArrivalTime) {
+		r.Fastest = t
+	}
+	if r.Cheapest.Provider == "" || t.Price < r.Cheapest.Price {
+		r.Cheapest = t
+	}
+}
+
+func runReach() {
+	budget, err := time.ParseDuration(withinArg)
+	if err != nil || budget <= 0 {
+		fmt.Printf("Invalid --within %q: use a duration such as 4h or 2h30m\n", withinArg)
+		os.Exit(1)
+	}
+	dates, err := utils.ParseDates(dateArg)
+	if err != nil {
+		fmt.Printf("Date error: %v\n", err)
+		os.Exit(1)
+	}
+	pList := selectProviders(provArg)
+	if len(pList) == 0 {
+		fmt.Printf("Unknown provider: %s\n", provArg)
+		os.Exit(1)
+	}
+
+	reg := places.NewRegistry(langArg)
+	res := newResolver(reg)
+	originMatches := make(placeMatches)
+	origins := make(map[string][]models.Location)
+	for _, p := range pList {
+		origins[p.Name()] = uniqueLocations(resolveNames(p, "Origin", splitList(fromArg), res, originMatches), "")
+	}
+	reportMismatches("Origin", originMatches)
+
+	results := make(map[string]*reachResult)
+	originPlaces := make(map[string]bool)
+	firstLegs := make(map[string][]models.Trip)
+	inner, outer := 0.0, budget.Hours()*reachStartKmh
+	maxKm := budget.Hours() * reachMaxKmh
+
+	for {
+		fmt.Printf("\nSearching places %.0f-%.0fkm away...\n", inner, outer)
+		var pairs []searchPair
+		for _, p := range pList {
+			for _, from := range origins[p.Name()] {
+				lat, lon, err := res.center(p, from)
+				if err != nil {
+					utils.DebugLog("%s: no coordinates for %s: %v", p.Name(), from.Name, err)
+					continue
+				}
+				locs, err := p.SearchLocationsByDistance(lat, lon, inner, outer)
+				if err != nil {
+					utils.DebugLog("%s: distance search error: %v", p.Name(), err)
+					continue
+				}
+				for _, l := range uniqueLocations(locs, from.ID) {
+					reg.Add(p.Name(), l)
+					pairs = append(pairs, searchPair{Provider: p, From: from, To: l})
+				}
+			}
+		}
+
+		reachable := 0
+		for _, t := range searchPairs(pairs, dates, reg) {
+			originPlaces[t.OriginPlace] = true
+			if t.Transfers > reachMaxTransfers || tripDuration(t) > budget || t.DestinationPlace == t.OriginPlace {
+				continue
+			}
+			reachable++
+			if results[t.DestinationPlace] == nil {
+				results[t.DestinationPlace] = &reachResult{Place: t.DestinationPlace}
+			}
+			results[t.DestinationPlace].add(t)
+			if t.Transfers == 0 {
+				firstLegs[t.DestinationPlace] = append(firstLegs[t.DestinationPlace], t)
+			}
+		}
+		fmt.Printf("\n%d trips within %s in this ring\n", reachable, withinArg)
+		if reachable == 0 || outer >= maxKm {
+			break
+		}
+		inner, outer = outer, math.Min(outer*reachGrowth, maxKm)
+	}
+
+	for _, t := range composeOnward(firstLegs, originPlaces, pList, dates, reg, budget) {
+		if results[t.DestinationPlace] == nil {
+			results[t.DestinationPlace] = &reachResult{Place: t.DestinationPlace}
+		}
+		results[t.DestinationPlace].add(t)
+	}
+
+	if len(results) == 0 {
+		fmt.Printf("\nNothing reachable within %s.\n", withinArg)
+		return
+	}
+
+	sorted := make([]*reachResult, 0, len(results))
+	for _, r := range results {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return tripDuration(sorted[i].Fastest) < tripDuration(sorted[j].Fastest)
+	})
+
+	printReach(sorted)
+	saveReachGeoJSON(sorted, originPlaces, reg)
+}
+
+// Providers report only the changes within their own connections, so
+// one-change trips are also composed here: from the reachHubs places reached
+// fastest by a direct ride, onward rides on every provider serving the place
+// are searched, nearest destinations first, and joined to the first leg.
+const (
+	reachHubs      = 4
+	reachOnwardMax = 20
+	reachMinChange = 10 * time.Minute
+)
+
+func composeOnward(firstLegs map[string][]models.Trip, origins map[string]bool, pList []providers.Provider, dates []time.Time, reg *places.Registry, budget time.Duration) []models.Trip {
+	type hub struct {
+		place   *places.Place
+		fastest time.Duration
+	}
+	byName := make(map[string]*places.Place)
+	for _, p := range reg.Places() {
+		byName[p.Name] = p
+	}
+	var hubs []hub
+	for name, legs := range firstLegs {
+		if byName[name] == nil || origins[name] {
+			continue
+		}
+		h := hub{place: byName[name], fastest: tripDuration(legs[0])}
+		for _, t := range legs {
+			h.fastest = min(h.fastest, tripDuration(t))
+		}
+		if budget-h.fastest > reachMinChange {
+			hubs = append(hubs, h)
+		}
+	}
+	sort.Slice(hubs, func(i, j int) bool { return hubs[i].fastest < hubs[j].fastest })
+	if len(hubs) > reachHubs {
+		hubs = hubs[:reachHubs]
+	}
+	if len(hubs) == 0 {
+		return nil
+	}
+
+	var pairs []searchPair
+	for _, h := range hubs {
+		radius := (budget - h.fastest - reachMinChange).Hours() * reachMaxKmh
+		for _, p := range pList {
+			from, ok := h.place.Locations[p.Name()]
+			if !ok || from.Latitude == 0 && from.Longitude == 0 {
+				continue
+			}
+			locs, err := p.SearchLocationsByDistance(from.Latitude, from.Longitude, 0, radius)
+			if err != nil {
+				utils.DebugLog("%s: distance search error: %v", p.Name(), err)
+				continue
+			}
+			sort.Slice(locs, func(i, j int) bool { return locs[i].Distance < locs[j].Distance })
+			n := 0
+			for _, l := range uniqueLocations(locs, from.ID) {
+				if n == reachOnwardMax {
+					break
+				}
+				if pl := reg.Add(p.Name(), l); pl == h.place || origins[pl.Name] {
+					continue
+				}
+				pairs = append(pairs, searchPair{Provider: p, From: from, To: l})
+				n++
+			}
+		}
+	}
+
+	fmt.Printf("\nSearching onward trips from %d change points...\n", len(hubs))
+	var composed []models.Trip
+	for _, o := range searchPairs(pairs, dates, reg) {
+		if o.Transfers > 0 || origins[o.DestinationPlace] {
+			continue
+		}
+		// The latest first leg that still makes the change is the shortest.
+		var best *models.Trip
+		for i, f := range firstLegs[o.OriginPlace] {
+			if o.DepartureTime.Sub(f.ArrivalTime) < reachMinChange || o.ArrivalTime.Sub(f.DepartureTime) > budget {
+				continue
+			}
+			if best == nil || f.DepartureTime.After(best.DepartureTime) {
+				best = &firstLegs[o.OriginPlace][i]
+			}
+		}
+		if best == nil {
+			continue
+		}
+		t := joinTrips(*best, o)
+		// The onward distance is measured from the change point, not the origin.
+		t.Distance = 0
+		if from, dest := byName[best.OriginPlace], byName[o.DestinationPlace]; from != nil && dest != nil {
+			t.Distance = utils.HaversineDistance(from.Latitude, from.Longitude, dest.Latitude, dest.Longitude)
+		}
+		composed = append(composed, t)
+	}
+	fmt.Printf("\n%d trips with one change within %s\n", len(composed), withinArg)
+	return composed
+}
+
+// legSegments returns the segments of a trip, or the trip itself as a single
+// segment when the provider gave none.
+func legSegments(t models.Trip) []models.Segment {
+	if len(t.Segments) > 0 {
+		return t.Segments
+	}
+	return []models.Segment{{
+		OriginStation:      t.OriginStation,
+		DestinationStation: t.DestinationStation,
+		DepartureTime:      t.DepartureTime,
+		ArrivalTime:        t.ArrivalTime,
+		VehicleType:        t.VehicleType,
+	}}
+}
+
+// joinTrips chains two trips booked separately into one with a change
+// between them.
+func joinTrips(a, b models.Trip) models.Trip {
+	t := b
+	t.DepartureTime = a.DepartureTime
+	t.OriginStation = a.OriginStation
+	t.OriginPlace = a.OriginPlace
+	t.Duration = formatDuration(b.ArrivalTime.Sub(a.DepartureTime))
+	t.Price = a.Price + b.Price
+	t.Transfers = a.Transfers + b.Transfers + 1
+	t.Segments = append(append([]models.Segment{}, legSegments(a)...), legSegments(b)...)
+	t.Fares, t.Amenities = nil, nil
+	t.BookingURL = a.BookingURL
+	if a.Provider != b.Provider {
+		t.Provider = a.Provider + "+" + b.Provider
+	}
+	if a.VehicleType != b.VehicleType {
+		t.VehicleType = a.VehicleType + ", " + b.VehicleType
+	}
+	if a.SeatsKnown && (!b.SeatsKnown || a.Seats < b.Seats) {
+		t.Seats, t.SeatsKnown = a.Seats, true
+	}
+	return t
+}
+
+func printReach(results []*reachResult) {
+	fmt.Printf("\n--- %d places reachable within %s ---\n", len(results), withinArg)
+	fmt.Printf("%-25s | %5s | %-8s | %-11s | %-11s | %-12s | %-10s | %s\n", "Place", "Km", "Fastest", "Dep", "Arr", "Provider", "Cheapest", "Provider")
+	for _, r := range results {
+		f, c := r.Fastest, r.Cheapest
+		fmt.Printf("%-25s | %5.0f | %-8s | %-11s | %-11s | %-12s | %7.2f%s | %s\n",
+			r.Place, r.Distance,
+			formatDuration(tripDuration(f)),
+			f.DepartureTime.Format("02.01 15:04"),
+			f.ArrivalTime.Format("02.01 15:04"),
+			f.Provider,
+			c.Price, c.Currency, c.Provider,
+		)
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%02dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+type geoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+}
+
+type geoFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   *geoPoint              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func placePoint(p *places.Place) *geoPoint {
+	if p == nil || p.Latitude == 0 && p.Longitude == 0 {
+		return nil
+	}
+	return &geoPoint{Type: "Point", Coordinates: [2]float64{p.Longitude, p.Latitude}}
+}
+
+// saveReachGeoJSON writes the origin and every reachable place as GeoJSON
+// points, ready to drop onto a map.
+func saveReachGeoJSON(results []*reachResult, origins map[string]bool, reg *places.Registry) {
+	byName := make(map[string]*places.Place)
+	for _, p := range reg.Places() {
+		byName[p.Name] = p
+	}
+
+	fc := geoFeatureCollection{Type: "FeatureCollection"}
+	for name := range origins {
+		fc.Features = append(fc.Features, geoFeature{
+			Type:       "Feature",
+			Geometry:   placePoint(byName[name]),
+			Properties: map[string]interface{}{"name": name, "role": "origin"},
+		})
+	}
+	for _, r := range results {
+		props := map[string]interface{}{
+			"name":              r.Place,
+			"role":              "destination",
+			"distance_km":       math.Round(r.Distance),
+			"fastest_minutes":   int(tripDuration(r.Fastest).Minutes()),
+			"fastest_departure": r.Fastest.DepartureTime.Format(time.RFC3339),
+			"fastest_arrival":   r.Fastest.ArrivalTime.Format(time.RFC3339),
+			"fastest_provider":  r.Fastest.Provider,
+			"fastest_transfers": r.Fastest.Transfers,
+			"cheapest_price":    r.Cheapest.Price,
+			"cheapest_currency": r.Cheapest.Currency,
+			"cheapest_provider": r.Cheapest.Provider,
+		}
+		if p := byName[r.Place]; p != nil {
+			props["country"] = p.Country
+		}
+		fc.Features = append(fc.Features, geoFeature{
+			Type:       "Feature",
+			Geometry:   placePoint(byName[r.Place]),
+			Properties: props,
+		})
+	}
+
+	savePath := outArg
+	if savePath == "" {
+		home, _ := os.UserHomeDir()
+		dir := filepath.Join(home, "trips")
+		os.MkdirAll(dir, 0755)
+		savePath = filepath.Join(dir, fmt.Sprintf("reach_%s_%s_%s.geojson",
+			strings.ReplaceAll(fromArg, " ", "_"), withinArg, time.Now().Format("20060102_150405")))
+	}
+
+	data, err := json.MarshalIndent(fc, "", "  ")
+	if err == nil {
+		err = os.WriteFile(savePath, data, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Error saving file: %v\n", err)
+		return
+	}
+	fmt.Printf("\nSaved GeoJSON to %s\n", savePath)
+}
@@ -0,0 +1,324 @@
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+// The HTML report is a single file with its styles and script inlined, so
+// it can be mailed or shared as it is.
+//
+//go:embed data/report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+// reportColors are the chart colors of the providers, in order of appearance.
+var reportColors = []string{"#2b7bb9", "#e4572e", "#4f9d69", "#9c6ade", "#f0a202", "#5c6b73"}
+
+type reportTrip struct {
+	Num         int
+	Provider    string
+	Color       string
+	Departure   string
+	Arrival     string
+	DepUnix     int64
+	DepHour     int
+	ArrUnix     int64
+	Duration    string
+	DurMinutes  int
+	Transfers   int
+	Price       float64
+	PriceText   string
+	PerPerson   string
+	Original    string
+	Seats       string
+	Origin      string
+	Destination string
+	Place       string
+	Via         string
+	Fares       string
+	Amenities   string
+	BookingURL  string
+}
+
+type reportPlace struct {
+	Name      string
+	Distance  string
+	Trips     int
+	Cheapest  string
+	Fastest   string
+	Providers []string
+}
+
+type reportProvider struct {
+	Name, Color string
+}
+
+type reportData struct {
+	Title     string
+	Subtitle  string
+	Generated string
+	Notes     []string
+	Providers []reportProvider
+	Trips     []reportTrip
+	Places    []reportPlace
+	Chart     template.HTML
+}
+
+// reportTime formats a time for readers outside the terminal, e.g.
+// "Fri 24 Oct 08:15".
+func reportTime(t time.Time) string {
+	return displayTime(t).Format("Mon 2 Jan 15:04")
+}
+
+func priceText(price float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", price, currency)
+}
+
+// saveHTML writes the trips as a self-contained HTML report with a sortable
+// and filterable table, a summary per destination and a price chart.
+func saveHTML(path string, trips []models.Trip) error {
+	data := reportData{
+		Title:     fmt.Sprintf("Trips from %s to %s", fromArg, reportDestination()),
+		Generated: time.Now().Format("Mon 2 Jan 2006 15:04"),
+	}
+
+	colors := make(map[string]string)
+	for _, t := range trips {
+		if _, ok := colors[t.Provider]; !ok {
+			colors[t.Provider] = reportColors[len(colors)%len(reportColors)]
+			data.Providers = append(data.Providers, reportProvider{t.Provider, colors[t.Provider]})
+		}
+	}
+
+	if len(trips) > 0 {
+		first, last := departureRange(trips)
+		data.Subtitle = fmt.Sprintf("%d trips departing %s", len(trips), displayTime(first).Format("Mon 2 Jan 2006"))
+		if d := displayTime(last).Format("Mon 2 Jan 2006"); d != displayTime(first).Format("Mon 2 Jan 2006") {
+			data.Subtitle += " to " + d
+		}
+	}
+
+	if partySize() > 1 {
+		data.Notes = append(data.Notes, fmt.Sprintf("Prices are totals for %d passengers.", partySize()))
+	}
+	if displayZone != nil {
+		data.Notes = append(data.Notes, fmt.Sprintf("Times are in %s.", displayZone))
+	} else {
+		data.Notes = append(data.Notes, "Times are local to each station.")
+	}
+	converted := 0
+	for _, t := range trips {
+		if t.OriginalCurrency != "" {
+			converted++
+		}
+	}
+	if converted > 0 {
+		r := utils.Rates()
+		data.Notes = append(data.Notes, fmt.Sprintf("%d prices converted to %s at rates of %s (%s).", converted, targetCurrency(), r.Date, r.Source))
+	}
+
+	for i, t := range trips {
+		rt := reportTrip{
+			Num:         i + 1,
+			Provider:    t.Provider,
+			Color:       colors[t.Provider],
+			Departure:   reportTime(t.DepartureTime),
+			Arrival:     reportTime(t.ArrivalTime),
+			DepUnix:     t.DepartureTime.Unix(),
+			DepHour:     displayTime(t.DepartureTime).Hour(),
+			ArrUnix:     t.ArrivalTime.Unix(),
+			Duration:    formatDuration(tripDuration(t)),
+			DurMinutes:  int(tripDuration(t).Minutes()),
+			Transfers:   t.Transfers,
+			Price:       t.Price,
+			PriceText:   priceText(t.Price, t.Currency),
+			Seats:       seatsCell(t.Seats, t.SeatsKnown),
+			Origin:      t.OriginStation,
+			Destination: t.DestinationStation,
+			Place:       t.DestinationPlace,
+			Via:         viaCell(t, ", "),
+			Fares:       faresCell(t.Fares, ", "),
+			Amenities:   strings.Join(t.Amenities, ", "),
+			BookingURL:  t.BookingURL,
+		}
+		if partySize() > 1 {
+			rt.PerPerson = priceText(t.Price/float64(partySize()), t.Currency) + " each"
+		}
+		if t.OriginalCurrency != "" {
+			rt.Original = priceText(t.OriginalPrice, t.OriginalCurrency)
+		}
+		data.Trips = append(data.Trips, rt)
+	}
+
+	data.Places = reportPlaces(trips)
+	data.Chart = priceChart(trips, colors)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return reportTemplate.Execute(f, data)
+}
+
+// departureRange returns the earliest and latest departure of the trips.
+func departureRange(trips []models.Trip) (first, last time.Time) {
+	first, last = trips[0].DepartureTime, trips[0].DepartureTime
+	for _, t := range trips {
+		if t.DepartureTime.Before(first) {
+			first = t.DepartureTime
+		}
+		if t.DepartureTime.After(last) {
+			last = t.DepartureTime
+		}
+	}
+	return first, last
+}
+
+func reportDestination() string {
+	switch {
+	case distArg > 0:
+		return "anywhere within " + distanceLabel()
+	case toArg != "":
+		return toArg
+	}
+	return "anywhere"
+}
+
+// reportPlaces summarizes every destination place: the cheapest and fastest
+// trip and the cheapest fare of every provider.
+func reportPlaces(trips []models.Trip) []reportPlace {
+	byPlace := make(map[string][]models.Trip)
+	for _, t := range trips {
+		byPlace[t.DestinationPlace] = append(byPlace[t.DestinationPlace], t)
+	}
+
+	var out []reportPlace
+	for name, list := range byPlace {
+		cheapest, fastest := list[0], list[0]
+		bestByProvider := make(map[string]models.Trip)
+		p := reportPlace{Name: name, Trips: len(list)}
+		for _, t := range list {
+			if t.Price < cheapest.Price {
+				cheapest = t
+			}
+			if tripDuration(t) < tripDuration(fastest) {
+				fastest = t
+			}
+			if b, ok := bestByProvider[t.Provider]; !ok || t.Price < b.Price {
+				bestByProvider[t.Provider] = t
+			}
+			if t.Distance > 0 {
+				p.Distance = fmt.Sprintf("%.0f km", t.Distance)
+			}
+		}
+		p.Cheapest = fmt.Sprintf("%s, %s %s", priceText(cheapest.Price, cheapest.Currency), cheapest.Provider, reportTime(cheapest.DepartureTime))
+		p.Fastest = fmt.Sprintf("%s, %s %s", formatDuration(tripDuration(fastest)), fastest.Provider, reportTime(fastest.DepartureTime))
+
+		provs := make([]string, 0, len(bestByProvider))
+		for prov := range bestByProvider {
+			provs = append(provs, prov)
+		}
+		sort.Slice(provs, func(i, j int) bool { return bestByProvider[provs[i]].Price < bestByProvider[provs[j]].Price })
+		for _, prov := range provs {
+			b := bestByProvider[prov]
+			p.Providers = append(p.Providers, fmt.Sprintf("%s %s", prov, priceText(b.Price, b.Currency)))
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Size of the price chart and the room left for its axes.
+const (
+	chartWidth, chartHeight = 900, 320
+	chartLeft, chartBottom  = 60, 40
+	chartTop, chartRight    = 15, 20
+)
+
+// priceChart plots the price of every trip against its departure time as an
+// inline SVG. Points carry the trip number so the page script can link them
+// to the table.
+func priceChart(trips []models.Trip, colors map[string]string) template.HTML {
+	if len(trips) == 0 {
+		return ""
+	}
+	first, last := departureRange(trips)
+	maxPrice := 0.0
+	for _, t := range trips {
+		maxPrice = math.Max(maxPrice, t.Price)
+	}
+	span := last.Sub(first)
+	if span < time.Hour {
+		first = first.Add(-30 * time.Minute)
+		span = time.Hour
+	}
+	step := niceStep(maxPrice / 4)
+	top := math.Max(step*math.Ceil(maxPrice/step), step)
+
+	plotW := float64(chartWidth - chartLeft - chartRight)
+	plotH := float64(chartHeight - chartTop - chartBottom)
+	x := func(t time.Time) float64 { return chartLeft + plotW*float64(t.Sub(first))/float64(span) }
+	y := func(p float64) float64 { return chartTop + plotH*(1-p/top) }
+
+	// Axis labels use the zone of the earliest departure unless --tz is set.
+	zone := displayTime(first).Location()
+	labelFormat := "15:04"
+	if span > 20*time.Hour {
+		labelFormat = "Mon 15:04"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg viewBox="0 0 %d %d" role="img" aria-label="Price by departure time">`, chartWidth, chartHeight)
+	for p := 0.0; p <= top+step/2; p += step {
+		fmt.Fprintf(&sb, `<line class="grid" x1="%d" x2="%d" y1="%.1f" y2="%.1f"/>`, chartLeft, chartWidth-chartRight, y(p), y(p))
+		fmt.Fprintf(&sb, `<text class="axis" x="%d" y="%.1f" text-anchor="end">%s</text>`, chartLeft-6, y(p)+4, formatTick(p))
+	}
+	for i := 0; i <= 6; i++ {
+		t := first.Add(span * time.Duration(i) / 6)
+		fmt.Fprintf(&sb, `<text class="axis" x="%.1f" y="%d" text-anchor="middle">%s</text>`,
+			x(t), chartHeight-chartBottom+18, template.HTMLEscapeString(t.In(zone).Format(labelFormat)))
+	}
+	fmt.Fprintf(&sb, `<text class="axis" x="%d" y="%d" text-anchor="end">Departure (%s)</text>`,
+		chartWidth-chartRight, chartHeight-4, template.HTMLEscapeString(zone.String()))
+	for i, t := range trips {
+		fmt.Fprintf(&sb, `<circle data-num="%d" cx="%.1f" cy="%.1f" r="5" fill="%s"><title>%s</title></circle>`,
+			i+1, x(t.DepartureTime), y(t.Price), colors[t.Provider],
+			template.HTMLEscapeString(fmt.Sprintf("#%d %s, %s, %s to %s", i+1, t.Provider, priceText(t.Price, t.Currency), reportTime(t.DepartureTime), t.DestinationPlace)))
+	}
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
+
+// niceStep rounds a raw axis step up to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*mag {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+func formatTick(p float64) string {
+	if p == math.Trunc(p) {
+		return fmt.Sprintf("%.0f", p)
+	}
+	return fmt.Sprintf("%.1f", p)
+}
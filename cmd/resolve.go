@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/places"
+	"github.com/yuriiter/trips/pkg/providers"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+// Candidates further apart than this are treated as different places when
+// deciding whether a query is ambiguous.
+const ambiguityRadiusKm = 30.0
+
+// Coordinates typed as a query snap to the provider's nearest location within
+// this radius.
+const coordSnapRadiusKm = 25.0
+
+// stdin is shared by every prompt, so input typed ahead of one prompt and
+// already buffered is still there for the next.
+var stdin = bufio.NewReader(os.Stdin)
+
+type ambiguousError struct {
+	Query      string
+	Provider   string
+	Candidates []models.Location
+}
+
+func (e *ambiguousError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "'%s' is ambiguous on %s, candidates:\n", e.Query, e.Provider)
+	for i, c := range e.Candidates {
+		fmt.Fprintf(&b, "  %d. %s\n", i+1, describeCandidate(c))
+	}
+	b.WriteString("Use a more specific name")
+	return b.String()
+}
+
+// resolver picks one location per query and provider. Once a query has been
+// resolved, other providers are steered to the same canonical place.
+type resolver struct {
+	reg         *places.Registry
+	chosen      map[string]*places.Place
+	points      map[string][2]float64
+	interactive bool
+}
+
+func newResolver(reg *places.Registry) *resolver {
+	return &resolver{
+		reg:         reg,
+		chosen:      make(map[string]*places.Place),
+		points:      make(map[string][2]float64),
+		interactive: isTerminal(os.Stdin) && isTerminal(os.Stdout),
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func describeCandidate(c models.Location) string {
+	s := fmt.Sprintf("%s [%s]", c.Name, c.Type)
+	if c.Country != "" {
+		s += " " + c.Country
+	}
+	if c.Latitude != 0 || c.Longitude != 0 {
+		s += fmt.Sprintf(" (%.4f, %.4f)", c.Latitude, c.Longitude)
+	}
+	return s
+}
+
+// strongMatches returns the candidates whose name itself matches the query
+// well, which is what makes a choice ambiguous to the user.
+func strongMatches(query string, cands []models.Location) []models.Location {
+	var strong []models.Location
+	for _, c := range cands {
+		if utils.MatchScore(query, c.Name) >= 0.9 {
+			strong = append(strong, c)
+		}
+	}
+	return strong
+}
+
+func isAmbiguous(query string, cands []models.Location) bool {
+	strong := strongMatches(query, cands)
+	for i := 1; i < len(strong); i++ {
+		a, b := strong[0], strong[i]
+		if a.Country != "" && b.Country != "" && a.Country != b.Country {
+			return true
+		}
+		hasCoords := (a.Latitude != 0 || a.Longitude != 0) && (b.Latitude != 0 || b.Longitude != 0)
+		if hasCoords && utils.HaversineDistance(a.Latitude, a.Longitude, b.Latitude, b.Longitude) > ambiguityRadiusKm {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *resolver) resolve(p providers.Provider, query string) (*models.Location, error) {
+	// A known name is resolved to its place once, before any provider is
+	// asked; otherwise the first provider's pick decides.
+	if _, ok := r.chosen[query]; !ok {
+		if named := places.ResolveName(query); named != nil {
+			r.chosen[query] = r.reg.Named(named)
+		}
+	}
+
+	cands, err := r.candidates(p, query)
+	if err != nil || len(cands) == 0 {
+		return nil, err
+	}
+
+	if place := r.chosen[query]; place != nil {
+		for i := range cands {
+			if place.Matches(cands[i]) {
+				return &cands[i], nil
+			}
+		}
+	}
+
+	pick := &cands[0]
+	if isAmbiguous(query, cands) {
+		if !r.interactive {
+			return nil, &ambiguousError{Query: query, Provider: p.Name(), Candidates: cands}
+		}
+		pick, err = promptCandidate(query, p.Name(), cands)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := r.chosen[query]; !ok {
+		r.chosen[query] = r.reg.Add(p.Name(), *pick)
+	}
+	return pick, nil
+}
+
+// candidates searches a provider for the query. Known exonyms are first mapped
+// to their place, and every name of that place is tried until the provider
+// returns a location actually at it ("Pressburg" finds "Bratislava").
+func (r *resolver) candidates(p providers.Provider, query string) ([]models.Location, error) {
+	named := places.ResolveName(query)
+	if named == nil {
+		return p.SearchLocationCandidates(query)
+	}
+
+	var firstErr error
+	for _, name := range append([]string{query}, named.QueryNames()...) {
+		cands, err := p.SearchLocationCandidates(name)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		var near []models.Location
+		for _, c := range cands {
+			if named.Near(c) {
+				near = append(near, c)
+			}
+		}
+		if len(near) > 0 {
+			utils.DebugLog("%s: '%s' resolved via '%s'", p.Name(), query, name)
+			return near, nil
+		}
+	}
+	return nil, firstErr
+}
+
+// resolvePoint snaps typed coordinates to the provider's nearest location and
+// remembers the exact point as the centre of radius searches from it.
+func (r *resolver) resolvePoint(p providers.Provider, lat, lon float64) (*models.Location, error) {
+	locs, err := p.SearchLocationsByDistance(lat, lon, 0, coordSnapRadiusKm)
+	if err != nil {
+		return nil, err
+	}
+	if len(locs) == 0 {
+		return nil, fmt.Errorf("nothing within %.0fkm of %.4f,%.4f", coordSnapRadiusKm, lat, lon)
+	}
+	nearest := locs[0]
+	for _, l := range locs[1:] {
+		if l.Distance < nearest.Distance {
+			nearest = l
+		}
+	}
+	r.points[p.Name()+"/"+nearest.ID] = [2]float64{lat, lon}
+	return &nearest, nil
+}
+
+// center returns the point radius searches from loc are measured from: the
+// coordinates the user typed, else the location's own, else a geocode of its
+// name.
+func (r *resolver) center(p providers.Provider, loc models.Location) (lat, lon float64, err error) {
+	if pt, ok := r.points[p.Name()+"/"+loc.ID]; ok {
+		return pt[0], pt[1], nil
+	}
+	if loc.Latitude != 0 || loc.Longitude != 0 {
+		return loc.Latitude, loc.Longitude, nil
+	}
+	geo := searchOpts.Geocoder
+	if geo == nil {
+		geo = utils.Offline
+	}
+	lat, lon, err = geo.Geocode(loc.Name)
+	if err != nil && !geoOnline {
+		err = fmt.Errorf("%v; not in the offline dataset, try --online-geocoding", err)
+	}
+	return lat, lon, err
+}
+
+func promptCandidate(query, provider string, cands []models.Location) (*models.Location, error) {
+	fmt.Printf("\n'%s' is ambiguous on %s:\n", query, provider)
+	for i, c := range cands {
+		fmt.Printf("  %d. %s\n", i+1, describeCandidate(c))
+	}
+
+	for {
+		fmt.Printf("Choose [1-%d]: ", len(cands))
+		line, err := stdin.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		n, convErr := strconv.Atoi(strings.TrimSpace(line))
+		if convErr == nil && n >= 1 && n <= len(cands) {
+			return &cands[n-1], nil
+		}
+	}
+}
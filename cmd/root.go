@@ -2,17 +2,18 @@ package cmd
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/places"
 	"github.com/yuriiter/trips/pkg/providers"
 	"github.com/yuriiter/trips/pkg/utils"
 )
@@ -22,10 +23,25 @@ var (
 	toArg     string
 	dateArg   string
 	distArg   int
+	minDist   int
 	provArg   string
 	outArg    string
 	sortArg   string
+	langArg   string
 	debugFlag bool
+	geoOnline bool
+
+	passengersArg string
+	cardsArg      string
+	minSeatsArg   int
+	minLayoverArg string
+	maxLayoverArg string
+	tzArg         string
+	ratesArg      string
+	formatArg     string
+	viewArg       string
+	displayZone   *time.Location
+	searchOpts    providers.Options
 )
 
 var rootCmd = &cobra.Command{
@@ -33,6 +49,8 @@ var rootCmd = &cobra.Command{
 	Short: "Search for bus/train trips",
 	Run: func(cmd *cobra.Command, args []string) {
 		utils.SetDebug(debugFlag)
+		setupGeocoder()
+		setupRates()
 		runSearch()
 	},
 }
@@ -45,18 +63,73 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&fromArg, "from", "f", "", "Origin city or country")
+	rootCmd.Flags().StringVarP(&fromArg, "from", "f", "", "Origin city, country or lat,lon")
 	rootCmd.Flags().StringVarP(&toArg, "to", "t", "", "Destination city or country")
-	rootCmd.Flags().StringVarP(&dateArg, "date", "d", "tomorrow", "Date (YYYY-MM-DD, today, tomorrow)")
+	rootCmd.Flags().StringVarP(&dateArg, "date", "d", "tomorrow", "Date (YYYY-MM-DD, today, tomorrow, fri)")
 	rootCmd.Flags().IntVarP(&distArg, "distance", "D", 0, "Search destinations within X km of origin")
-	rootCmd.Flags().StringVarP(&provArg, "provider", "p", "all", "Provider (all, flixbus, regiojet)")
-	rootCmd.Flags().StringVarP(&outArg, "out", "o", "", "Output file path (CSV)")
-	rootCmd.Flags().StringVarP(&sortArg, "sort", "s", "price", "Sort by: price, departure")
-
-	rootCmd.Flags().BoolVarP(&debugFlag, "debug", "v", false, "Enable debug logs")
+	rootCmd.Flags().IntVar(&minDist, "min-distance", 0, "With --distance, skip destinations closer than X km")
+	rootCmd.Flags().StringVarP(&outArg, "out", "o", "", "Output file path")
+	rootCmd.Flags().StringVar(&formatArg, "format", "csv", "Output file format: csv, json, html")
+	rootCmd.Flags().StringVar(&viewArg, "view", "auto", "Results viewer: auto (tabview if installed, else tui in a terminal), tui, tabview, none")
+	rootCmd.Flags().StringVarP(&sortArg, "sort", "s", "price", "Sort by: price, departure, arrival, duration, transfers, score; comma separated for tie-breakers")
+	rootCmd.Flags().BoolVar(&paretoFlag, "pareto", false, "Keep only trips no other trip beats on price, duration and transfers")
+	rootCmd.Flags().BoolVar(&paretoRoute, "pareto-by-route", false, "Like --pareto, but compare trips only with others between the same places")
+	rootCmd.Flags().StringVar(&weightsArg, "weights", "", "Weights of the score, e.g. price=1,hour=5,transfer=10,night=15")
+	// Every command compares prices, so these are shared with all of them.
+	rootCmd.PersistentFlags().StringVar(&searchOpts.Currency, "currency", "EUR", "Currency to compare prices in, e.g. CZK, PLN, HUF")
+	rootCmd.PersistentFlags().StringVar(&ratesArg, "rates", "", "Exchange rate file (default ~/trips/rates.json, else built-in)")
+	rootCmd.Flags().StringVar(&tzArg, "tz", "local", "Show times in: local (each station's zone), system, utc or a zone such as Europe/London")
+	rootCmd.Flags().BoolVar(&searchOpts.FareClasses, "classes", false, "List every seat class as a trip of its own, with on-board amenities (Regiojet, slower)")
+	rootCmd.Flags().DurationVar(&searchOpts.AfterMidnight, "after-midnight", 0, "Also include rides leaving this long after midnight, e.g. 3h")
+	rootCmd.Flags().StringVar(&minLayoverArg, "min-layover", "", "Skip trips with a shorter connection, e.g. 15m")
+	rootCmd.Flags().StringVar(&maxLayoverArg, "max-layover", "", "Skip trips with a longer connection, e.g. 2h")
+	rootCmd.Flags().IntVar(&minSeatsArg, "min-seats", 0, "Skip trips with fewer free seats (default: number of passengers)")
+	addSearchFlags(rootCmd)
 	rootCmd.MarkFlagRequired("from")
 }
 
+// addSearchFlags registers the flags of every command that searches trips:
+// which providers to ask, for whom, and how places are named and found.
+func addSearchFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVarP(&provArg, "provider", "p", "all", "Provider (all, flixbus, regiojet, db, blablacar), comma separated")
+	f.StringVar(&passengersArg, "passengers", "1a", "Passengers: a adult, c child (with age), s senior, st student, e.g. 2a,1c:8")
+	f.StringVar(&cardsArg, "cards", "", "Discount cards of all passengers: isic, bahncard25, bahncard50")
+	f.StringVar(&langArg, "lang", "en", "Language of city names in place columns and summaries (en, de, cs, sk, pl, hu, ...); station names stay as providers spell them")
+	f.BoolVar(&geoOnline, "online-geocoding", false, "Fall back to Nominatim for places missing from the offline dataset")
+	f.BoolVarP(&debugFlag, "debug", "v", false, "Enable debug logs")
+}
+
+// setupGeocoder picks the geocoder handed to the providers and the resolver:
+// the offline dataset, with Nominatim behind it for --online-geocoding.
+func setupGeocoder() {
+	searchOpts.Geocoder = utils.Offline
+	if geoOnline {
+		searchOpts.Geocoder = utils.FallbackGeocoder{utils.Offline, utils.NominatimGeocoder{}}
+	}
+}
+
+func selectProviders(arg string) []providers.Provider {
+	var pList []providers.Provider
+	for _, name := range strings.Split(strings.ToLower(arg), ",") {
+		name = strings.TrimSpace(name)
+		all := name == "all"
+		if name == "flixbus" || all {
+			pList = append(pList, &providers.FlixbusProvider{Options: searchOpts})
+		}
+		if name == "regiojet" || all {
+			pList = append(pList, &providers.RegiojetProvider{Options: searchOpts})
+		}
+		if name == "db" || name == "deutschebahn" || all {
+			pList = append(pList, &providers.DeutscheBahnProvider{Options: searchOpts})
+		}
+		if name == "blablacar" || all {
+			pList = append(pList, &providers.BlaBlaCarBusProvider{Options: searchOpts})
+		}
+	}
+	return pList
+}
+
 func runSearch() {
 	dates, err := utils.ParseDates(dateArg)
 	if err != nil {
@@ -64,154 +137,445 @@ func runSearch() {
 		os.Exit(1)
 	}
 
-	var pList []providers.Provider
-	if provArg == "flixbus" || provArg == "all" {
-		pList = append(pList, &providers.FlixbusProvider{})
+	if minDist > 0 && minDist >= distArg {
+		fmt.Println("Error: --min-distance must be smaller than --distance")
+		os.Exit(1)
+	}
+
+	if sortBy, err = parseSortKeys(sortArg); err == nil {
+		weights, err = parseWeights(weightsArg)
 	}
-	if provArg == "regiojet" || provArg == "all" {
-		pList = append(pList, &providers.RegiojetProvider{})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	allTrips := []models.Trip{}
-	var tripMutex sync.Mutex
-	var wg sync.WaitGroup
+	// A front per route is still a front.
+	if paretoRoute {
+		paretoFlag = true
+	}
 
-	origins := strings.Split(fromArg, ",")
+	if searchOpts.AfterMidnight < 0 || searchOpts.AfterMidnight > 12*time.Hour {
+		fmt.Println("Error: --after-midnight must be between 0 and 12h")
+		os.Exit(1)
+	}
 
-	for _, p := range pList {
-		fmt.Printf("\n--- Searching on %s ---\n", p.Name())
+	if _, ok := utils.Rates().Rates[targetCurrency()]; !ok {
+		fmt.Printf("Error: no exchange rate for %s\n", targetCurrency())
+		os.Exit(1)
+	}
 
-		var fromLocs []models.Location
-		for _, oName := range origins {
-			oName = strings.TrimSpace(oName)
-			if cc := utils.GetCountryCodeByName(oName); cc != "" {
-				if distArg > 0 {
-					fmt.Printf("Warning: distance search not supported with country origin %s\n", oName)
-					continue
-				}
-				fmt.Printf("Expanding origin country %s...\n", oName)
-				locs, err := p.GetLocationsByCountry(cc)
-				if err == nil {
-					fromLocs = append(fromLocs, locs...)
-				}
-			} else {
-				loc, err := p.SearchLocationByName(oName)
-				if err == nil && loc != nil {
-					fromLocs = append(fromLocs, *loc)
-				} else {
-					fmt.Printf("Warning: Origin '%s' not found on %s (Error: %v)\n", oName, p.Name(), err)
-				}
+	if formatArg != "csv" && formatArg != "json" && formatArg != "html" {
+		fmt.Printf("Unknown --format %s\n", formatArg)
+		os.Exit(1)
+	}
+
+	view, err := resultsViewer(viewArg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if displayZone, err = parseDisplayZone(tzArg); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	minLayover, err := parseLayover("--min-layover", minLayoverArg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	maxLayover, err := parseLayover("--max-layover", maxLayoverArg)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	setupPassengers()
+
+	pList := selectProviders(provArg)
+	if len(pList) == 0 {
+		fmt.Printf("Unknown provider: %s\n", provArg)
+		os.Exit(1)
+	}
+
+	reg := places.NewRegistry(langArg)
+	res := newResolver(reg)
+	originMatches := make(placeMatches)
+	destMatches := make(placeMatches)
+
+	fromByProvider := make(map[string][]models.Location)
+	for _, p := range pList {
+		var origins []string
+		for _, oName := range splitList(fromArg) {
+			if utils.LookupArea(oName) != nil && distArg > 0 {
+				fmt.Printf("Warning: distance search not supported with area origin %s\n", oName)
+				continue
 			}
+			origins = append(origins, oName)
 		}
+		fromByProvider[p.Name()] = uniqueLocations(resolveNames(p, "Origin", origins, res, originMatches), "")
+	}
+	reportMismatches("Origin", originMatches)
 
-		uniqueFrom := make(map[string]models.Location)
-		for _, l := range fromLocs {
-			uniqueFrom[l.ID] = l
+	if distArg == 0 && toArg == "" {
+		fmt.Println("Error: --to or --distance required")
+		os.Exit(1)
+	}
+
+	var pairs []searchPair
+	for _, p := range pList {
+		fmt.Printf("\n--- Searching on %s ---\n", p.Name())
+
+		var toLocs []models.Location
+		if distArg == 0 {
+			toLocs = resolveNames(p, "Destination", splitList(toArg), res, destMatches)
 		}
 
-		for _, from := range uniqueFrom {
+		for _, from := range fromByProvider[p.Name()] {
 			fmt.Printf("\nSearching trips from: %s\n", from.Name)
 
-			var destLocs []models.Location
+			destLocs := toLocs
 			if distArg > 0 {
-				fmt.Printf("Finding destinations within %dkm...\n", distArg)
-				locs, err := p.SearchLocationsByDistance(from.Name, distArg)
+				lat, lon, err := res.center(p, from)
 				if err != nil {
-					utils.DebugLog("Distance search error: %v", err)
+					fmt.Printf("Warning: no coordinates for %s (%v)\n", from.Name, err)
+					continue
 				}
-				destLocs = append(destLocs, locs...)
-			} else if toArg != "" {
-				toNames := strings.Split(toArg, ",")
-				for _, tName := range toNames {
-					tName = strings.TrimSpace(tName)
-					if cc := utils.GetCountryCodeByName(tName); cc != "" {
-						fmt.Printf("Expanding destination country %s...\n", tName)
-						locs, err := p.GetLocationsByCountry(cc)
-						if err == nil {
-							destLocs = append(destLocs, locs...)
-						}
-					} else {
-						loc, err := p.SearchLocationByName(tName)
-						if err == nil && loc != nil {
-							destLocs = append(destLocs, *loc)
-						}
-					}
+				fmt.Printf("Finding destinations within %s...\n", distanceLabel())
+				locs, err := p.SearchLocationsByDistance(lat, lon, float64(minDist), float64(distArg))
+				if err != nil {
+					utils.DebugLog("Distance search error: %v", err)
 				}
-			} else {
-				fmt.Println("Error: --to or --distance required")
-				os.Exit(1)
-			}
-
-			uniqueDest := make(map[string]models.Location)
-			for _, l := range destLocs {
-				if l.ID != from.ID {
-					uniqueDest[l.ID] = l
+				for _, l := range locs {
+					reg.Add(p.Name(), l)
 				}
+				destLocs = locs
 			}
 
+			uniqueDest := uniqueLocations(destLocs, from.ID)
 			fmt.Printf("Found %d unique destinations. Searching on %d dates...\n", len(uniqueDest), len(dates))
-
-			sem := make(chan struct{}, 8)
-
 			for _, dest := range uniqueDest {
-				for _, d := range dates {
-					wg.Add(1)
-					sem <- struct{}{}
-					go func(f, t models.Location, dt time.Time, prov providers.Provider) {
-						defer wg.Done()
-						defer func() { <-sem }()
-
-						trips, err := prov.SearchTrips(f, t, dt)
-						if err != nil {
-							utils.DebugLog("Error searching %s->%s: %v", f.Name, t.Name, err)
-							return
-						}
-						if len(trips) > 0 {
-							tripMutex.Lock()
-							allTrips = append(allTrips, trips...)
-							tripMutex.Unlock()
-							fmt.Print(".")
-						}
-					}(from, dest, d, p)
-				}
+				pairs = append(pairs, searchPair{Provider: p, From: from, To: dest})
 			}
-			wg.Wait()
+		}
+	}
+	reportMismatches("Destination", destMatches)
+
+	var found, allTrips []models.Trip
+	complete := true
+	if view == "tui" {
+		found, allTrips, complete, err = browseSearch(pairs, dates, reg, func(trips []models.Trip) []models.Trip {
+			return filterLayovers(bookableTrips(trips), minLayover, maxLayover)
+		})
+		if err != nil {
+			fmt.Printf("Warning: terminal browser unavailable (%v)\n", err)
+			view, complete = "none", true
+		} else if !complete {
+			fmt.Println("\nSearch stopped before all routes were searched.")
+		}
+	}
+	if view != "tui" {
+		found = searchAllPairs(pairs, dates, reg)
+		allTrips = bookableTrips(found)
+		if minLayover > 0 || maxLayover > 0 {
+			before := len(allTrips)
+			allTrips = filterLayovers(allTrips, minLayover, maxLayover)
+			fmt.Printf("\n%d of %d trips have connections within the layover limits\n", len(allTrips), before)
 		}
 	}
 
 	if len(allTrips) == 0 {
+		if complete {
+			reportAvailability(pairs, found, reg)
+		}
 		fmt.Println("\nNo trips found.")
 		return
 	}
 
-	sort.Slice(allTrips, func(i, j int) bool {
-		if sortArg == "departure" {
-			return allTrips[i].DepartureTime.Before(allTrips[j].DepartureTime)
-		}
-		return allTrips[i].Price < allTrips[j].Price
-	})
+	if paretoFlag {
+		before := len(allTrips)
+		allTrips = paretoFront(allTrips)
+		fmt.Printf("\nKept %d of %d trips on the price/duration/transfers front\n", len(allTrips), before)
+	}
+	sortTrips(allTrips, sortBy, weights)
 
 	printTrips(allTrips)
-	saveAndOpen(allTrips)
+	printPlaceSummary(allTrips)
+	if complete {
+		reportAvailability(pairs, found, reg)
+	}
+	saveAndOpen(allTrips, view == "tabview")
+}
+
+// resultsViewer checks --view and resolves auto as before the built-in
+// browser existed: tabview opens the saved CSV when it is installed and no
+// --out is given. Only without tabview does auto pick the browser, and only
+// when both stdin and stdout are terminals and debug logs are off.
+func resultsViewer(arg string) (string, error) {
+	switch arg {
+	case "tui", "tabview", "none":
+		return arg, nil
+	case "auto":
+		if outArg == "" && formatArg == "csv" {
+			if _, err := exec.LookPath("tabview"); err == nil {
+				return "tabview", nil
+			}
+		}
+		if isTerminal(os.Stdin) && isTerminal(os.Stdout) && !debugFlag {
+			return "tui", nil
+		}
+		return "none", nil
+	}
+	return "", fmt.Errorf("unknown --view %s (auto, tui, tabview, none)", arg)
+}
+
+// distanceLabel describes the radius search, e.g. "300km" or "150-400km".
+func distanceLabel() string {
+	if minDist > 0 {
+		return fmt.Sprintf("%d-%dkm", minDist, distArg)
+	}
+	return fmt.Sprintf("%dkm", distArg)
+}
+
+// setupPassengers reads --passengers and --cards into the search options.
+func setupPassengers() {
+	var err error
+	if searchOpts.Passengers, err = utils.ParsePassengers(passengersArg); err == nil {
+		searchOpts.Cards, err = providers.ParseCards(cardsArg)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// partySize is the number of passengers prices are quoted for.
+func partySize() int {
+	if len(searchOpts.Passengers) == 0 {
+		return 1
+	}
+	return len(searchOpts.Passengers)
+}
+
+// parseDisplayZone reads --tz; nil means every time in its station's zone.
+func parseDisplayZone(arg string) (*time.Location, error) {
+	switch strings.ToLower(arg) {
+	case "", "local", "station":
+		return nil, nil
+	case "system":
+		return time.Local, nil
+	case "utc":
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(arg)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", arg)
+	}
+	return loc, nil
+}
+
+func displayTime(t time.Time) time.Time {
+	if displayZone == nil {
+		return t
+	}
+	return t.In(displayZone)
+}
+
+// formatTimes formats departure and arrival for output, marking an arrival
+// on a later day with "+1", "+2", ...
+func formatTimes(t models.Trip) (dep, arr string) {
+	d, a := displayTime(t.DepartureTime), displayTime(t.ArrivalTime)
+	dep, arr = d.Format("02.01 15:04"), a.Format("02.01 15:04")
+	dy, dm, dd := d.Date()
+	ay, am, ad := a.Date()
+	days := int(time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC).Sub(time.Date(dy, dm, dd, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	if days > 0 {
+		arr += fmt.Sprintf("+%d", days)
+	}
+	return dep, arr
 }
 
 func printTrips(trips []models.Trip) {
 	fmt.Printf("\n--- Found %d trips ---\n", len(trips))
-	fmt.Printf("%-10s | %-12s | %-12s | %-6s | %-8s | %s -> %s\n", "Provider", "Dep", "Arr", "Price", "Dur", "Origin", "Dest")
+	if partySize() > 1 {
+		fmt.Printf("Prices are totals for %d passengers\n", partySize())
+	}
+	extraHeader := fmt.Sprintf("%5s | ", "Seats")
+	if partySize() > 1 {
+		extraHeader += fmt.Sprintf("%-9s | ", "Per pers.")
+	}
+	if distArg > 0 {
+		extraHeader += fmt.Sprintf("%5s | ", "Km")
+	}
+	if sortsByScore() {
+		extraHeader += fmt.Sprintf("%6s | ", "Score")
+	}
+	if displayZone != nil {
+		fmt.Printf("Times in %s\n", displayZone)
+	}
+	converted := 0
 	for _, t := range trips {
-		fmt.Printf("%-10s | %-12s | %-12s | %5.2f%s | %-8s | %s -> %s\n",
+		if t.OriginalCurrency != "" {
+			converted++
+		}
+	}
+	if converted > 0 {
+		r := utils.Rates()
+		fmt.Printf("%d prices converted to %s at rates of %s (%s)\n", converted, targetCurrency(), r.Date, r.Source)
+	}
+	fmt.Printf("%-4s | %-10s | %-11s | %-13s | %-6s | %-8s | %s%s -> %s\n", "#", "Provider", "Dep", "Arr", "Price", "Dur", extraHeader, "Origin", "Dest")
+	for i, t := range trips {
+		extra := fmt.Sprintf("%5s | ", seatsCell(t.Seats, t.SeatsKnown))
+		if partySize() > 1 {
+			extra += fmt.Sprintf("%9.2f | ", t.Price/float64(partySize()))
+		}
+		if distArg > 0 {
+			extra += fmt.Sprintf("%5.0f | ", t.Distance)
+		}
+		if sortsByScore() {
+			extra += fmt.Sprintf("%6.1f | ", weights.score(t))
+		}
+		dep, arr := formatTimes(t)
+		fmt.Printf("%-4d | %-10s | %-11s | %-13s | %5.2f%s | %-8s | %s%s -> %s\n",
+			i+1,
 			t.Provider,
-			t.DepartureTime.Format("02.01 15:04"),
-			t.ArrivalTime.Format("02.01 15:04"),
+			dep,
+			arr,
 			t.Price, t.Currency,
 			t.Duration,
+			extra,
 			t.OriginStation,
 			t.DestinationStation,
 		)
+		if len(t.Segments) > 1 {
+			fmt.Printf("    via %s\n", viaCell(t, ", "))
+		}
+		if len(t.Fares) > 0 {
+			fmt.Printf("    %s", faresCell(t.Fares, " | "))
+			if len(t.Amenities) > 0 {
+				fmt.Printf("  [%s]", strings.Join(t.Amenities, ", "))
+			}
+			fmt.Println()
+		}
+	}
+}
+
+// layovers returns the waiting time at every transfer of a trip with known
+// segments.
+func layovers(t models.Trip) []time.Duration {
+	var waits []time.Duration
+	for i := 1; i < len(t.Segments); i++ {
+		waits = append(waits, t.Segments[i].DepartureTime.Sub(t.Segments[i-1].ArrivalTime))
+	}
+	return waits
+}
+
+func parseLayover(flag, arg string) (time.Duration, error) {
+	if arg == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(arg)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q, use a duration such as 20m or 1h30m", flag, arg)
+	}
+	return d, nil
+}
+
+// filterLayovers drops trips with a connection shorter than shortest or
+// longer than longest, where set. Trips whose segments are unknown are kept.
+func filterLayovers(trips []models.Trip, shortest, longest time.Duration) []models.Trip {
+	var out []models.Trip
+next:
+	for _, t := range trips {
+		for _, w := range layovers(t) {
+			if shortest > 0 && w < shortest || longest > 0 && w > longest {
+				continue next
+			}
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// viaCell lists the transfer stations of a trip with the layover at each.
+func viaCell(t models.Trip, sep string) string {
+	var parts []string
+	for i, w := range layovers(t) {
+		station := t.Segments[i].DestinationStation
+		if next := t.Segments[i+1].OriginStation; next != station {
+			station += " / " + next
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s)", station, formatDuration(w)))
+	}
+	return strings.Join(parts, sep)
+}
+
+// faresCell lists seat classes with their price and free seats.
+func faresCell(fares []models.Fare, sep string) string {
+	parts := make([]string, len(fares))
+	for i, f := range fares {
+		parts[i] = fmt.Sprintf("%s %.2f (%s seats)", f.Class, f.Price, seatsCell(f.Seats, f.SeatsKnown))
+	}
+	return strings.Join(parts, sep)
+}
+
+// printPlaceSummary compares providers per canonical destination, so the same
+// city reached through different provider IDs is shown side by side.
+func printPlaceSummary(trips []models.Trip) {
+	type best struct {
+		price    float64
+		currency string
+	}
+	byPlace := make(map[string]map[string]best)
+	distance := make(map[string]float64)
+	for _, t := range trips {
+		if t.Distance > 0 {
+			distance[t.DestinationPlace] = t.Distance
+		}
+		if byPlace[t.DestinationPlace] == nil {
+			byPlace[t.DestinationPlace] = make(map[string]best)
+		}
+		if b, ok := byPlace[t.DestinationPlace][t.Provider]; !ok || t.Price < b.price {
+			byPlace[t.DestinationPlace][t.Provider] = best{t.Price, t.Currency}
+		}
+	}
+
+	placeNames := make([]string, 0, len(byPlace))
+	for name := range byPlace {
+		placeNames = append(placeNames, name)
+	}
+	sort.Strings(placeNames)
+
+	fmt.Printf("\n--- Cheapest by destination (%d places) ---\n", len(placeNames))
+	for _, name := range placeNames {
+		provs := make([]string, 0, len(byPlace[name]))
+		for prov := range byPlace[name] {
+			provs = append(provs, prov)
+		}
+		sort.Slice(provs, func(i, j int) bool { return byPlace[name][provs[i]].price < byPlace[name][provs[j]].price })
+
+		var parts []string
+		for _, prov := range provs {
+			b := byPlace[name][prov]
+			parts = append(parts, fmt.Sprintf("%s %.2f%s", prov, b.price, b.currency))
+		}
+		label := name
+		if d, ok := distance[name]; ok {
+			label = fmt.Sprintf("%s (%.0fkm)", name, d)
+		}
+		fmt.Printf("%-25s | %s\n", label, strings.Join(parts, " | "))
 	}
 }
 
-func saveAndOpen(trips []models.Trip) {
+// saveAndOpen saves the results and, with tabview set, shows the CSV file in
+// tabview when it is installed.
+func saveAndOpen(trips []models.Trip, tabview bool) {
+	if err := saveLastResults(trips); err != nil {
+		utils.DebugLog("Saving last results: %v", err)
+	}
+
 	savePath := outArg
 	if savePath == "" {
 		home, _ := os.UserHomeDir()
@@ -223,49 +587,123 @@ func saveAndOpen(trips []models.Trip) {
 			destName = strings.ReplaceAll(toArg, " ", "_")
 		}
 		if distArg > 0 {
-			destName = fmt.Sprintf("%dkm", distArg)
+			destName = distanceLabel()
 		}
 
-		fname := fmt.Sprintf("%s_%s_%s.csv",
+		fname := fmt.Sprintf("%s_%s_%s.%s",
 			strings.ReplaceAll(fromArg, " ", "_"),
 			destName,
-			time.Now().Format("20060102_150405"))
+			time.Now().Format("20060102_150405"),
+			formatArg)
 		savePath = filepath.Join(dir, fname)
 	}
 
-	f, err := os.Create(savePath)
-	if err == nil {
-		defer f.Close()
-		w := csv.NewWriter(f)
-		w.Write([]string{"Provider", "Departure", "Arrival", "Price", "Currency", "Duration", "Origin", "Destination", "Transfers", "VehicleType"})
-		for _, t := range trips {
-			w.Write([]string{
-				t.Provider,
-				t.DepartureTime.Format("02.01 15:04"),
-				t.ArrivalTime.Format("02.01 15:04"),
-				fmt.Sprintf("%.2f", t.Price),
-				t.Currency,
-				t.Duration,
-				t.OriginStation,
-				t.DestinationStation,
-				fmt.Sprintf("%d", t.Transfers),
-				t.VehicleType,
-			})
-		}
-		w.Flush()
-		fmt.Printf("\nSaved to %s\n", savePath)
-
-		if outArg == "" {
-			if path, err := exec.LookPath("tabview"); err == nil {
-				fmt.Println("Opening tabview...")
-				cmd := exec.Command(path, savePath)
-				cmd.Stdin = os.Stdin
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				cmd.Run()
-			}
-		}
-	} else {
+	var err error
+	switch formatArg {
+	case "json":
+		err = saveJSON(savePath, trips)
+	case "html":
+		err = saveHTML(savePath, trips)
+	default:
+		err = saveCSV(savePath, trips)
+	}
+	if err != nil {
 		fmt.Printf("Error saving file: %v\n", err)
+		return
+	}
+	fmt.Printf("\nSaved to %s\n", savePath)
+
+	if tabview && formatArg == "csv" {
+		path, err := exec.LookPath("tabview")
+		if err != nil {
+			fmt.Println("tabview is not installed")
+			return
+		}
+		fmt.Println("Opening tabview...")
+		cmd := exec.Command(path, savePath)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Run()
+	}
+}
+
+func saveJSON(path string, trips []models.Trip) error {
+	data, err := json.MarshalIndent(trips, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func saveCSV(path string, trips []models.Trip) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"Provider", "Departure", "Arrival", "Price", "Currency", "Duration", "Origin", "Destination", "Transfers", "VehicleType", "OriginPlace", "DestinationPlace", "DistanceKm", "PricePerPerson", "Seats", "Fares", "Amenities", "Via", "DepartureZone", "ArrivalZone", "OriginalPrice", "OriginalCurrency", "BookingURL"})
+	for _, t := range trips {
+		dep, arr := formatTimes(t)
+		w.Write([]string{
+			t.Provider,
+			dep,
+			arr,
+			fmt.Sprintf("%.2f", t.Price),
+			t.Currency,
+			t.Duration,
+			t.OriginStation,
+			t.DestinationStation,
+			fmt.Sprintf("%d", t.Transfers),
+			t.VehicleType,
+			t.OriginPlace,
+			t.DestinationPlace,
+			distanceCell(t.Distance),
+			fmt.Sprintf("%.2f", t.Price/float64(partySize())),
+			seatsCell(t.Seats, t.SeatsKnown),
+			faresCell(t.Fares, "; "),
+			strings.Join(t.Amenities, ", "),
+			viaCell(t, "; "),
+			zoneCell(displayTime(t.DepartureTime)),
+			zoneCell(displayTime(t.ArrivalTime)),
+			originalPriceCell(t),
+			t.OriginalCurrency,
+			t.BookingURL,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// zoneCell names the zone of a time by its IANA name, or by its UTC offset
+// when the zone has none; abbreviations such as CST are ambiguous.
+func zoneCell(t time.Time) string {
+	if name := t.Location().String(); name != "" && name != "Local" {
+		return name
+	}
+	return t.Format("-07:00")
+}
+
+func originalPriceCell(t models.Trip) string {
+	if t.OriginalCurrency == "" {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", t.OriginalPrice)
+}
+
+// seatsCell shows the free seats, "0" included, and "-" when the provider
+// does not report them.
+func seatsCell(seats int, known bool) string {
+	if !known {
+		return "-"
+	}
+	return fmt.Sprintf("%d", seats)
+}
+
+func distanceCell(km float64) string {
+	if km == 0 {
+		return ""
 	}
+	return fmt.Sprintf("%.0f", km)
 }
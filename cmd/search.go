@@ -0,0 +1,399 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/places"
+	"github.com/yuriiter/trips/pkg/providers"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+type searchPair struct {
+	Provider providers.Provider
+	From     models.Location
+	To       models.Location
+}
+
+// placeMatches records, per query and provider, which canonical place a name
+// resolved to.
+type placeMatches map[string]map[string]*places.Place
+
+func (m placeMatches) add(query, provider string, p *places.Place) {
+	if m[query] == nil {
+		m[query] = make(map[string]*places.Place)
+	}
+	m[query][provider] = p
+}
+
+// splitList splits a comma separated argument, keeping "lat,lon" pairs such
+// as "49.19,16.61" together.
+func splitList(arg string) []string {
+	var parts []string
+	for _, s := range strings.Split(arg, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+
+	var out []string
+	for i := 0; i < len(parts); i++ {
+		if i+1 < len(parts) {
+			pair := parts[i] + "," + parts[i+1]
+			if _, _, ok := utils.ParseCoordinates(pair); ok {
+				out = append(out, pair)
+				i++
+				continue
+			}
+		}
+		out = append(out, parts[i])
+	}
+	return out
+}
+
+// resolveNames expands countries, country groups and regions and looks up city
+// names on one provider, registering every location with the canonical place
+// registry.
+func resolveNames(p providers.Provider, role string, names []string, res *resolver, matches placeMatches) []models.Location {
+	reg := res.reg
+	var locs []models.Location
+	for _, name := range names {
+		if area := utils.LookupArea(name); area != nil {
+			fmt.Printf("Expanding %s %s (%s)...\n", role, area.Name, strings.Join(area.Countries, ", "))
+			for _, l := range expandArea(p, area) {
+				reg.Add(p.Name(), l)
+				locs = append(locs, l)
+			}
+			continue
+		}
+
+		if lat, lon, ok := utils.ParseCoordinates(name); ok {
+			loc, err := res.resolvePoint(p, lat, lon)
+			if err != nil {
+				fmt.Printf("Warning: %s %s has no location on %s (%v)\n", role, name, p.Name(), err)
+				continue
+			}
+			fmt.Printf("%s %s -> %s (%.1fkm away) on %s\n", role, name, loc.Name, loc.Distance, p.Name())
+			loc.Distance = 0
+			matches.add(name, p.Name(), reg.Add(p.Name(), *loc))
+			locs = append(locs, *loc)
+			continue
+		}
+
+		loc, err := res.resolve(p, name)
+		if amb, ok := err.(*ambiguousError); ok {
+			fmt.Printf("Error: %s %v\n", role, amb)
+			os.Exit(1)
+		}
+		if err != nil || loc == nil {
+			fmt.Printf("Warning: %s '%s' not found on %s (Error: %v)\n", role, name, p.Name(), err)
+			continue
+		}
+		matches.add(name, p.Name(), reg.Add(p.Name(), *loc))
+		locs = append(locs, *loc)
+	}
+	return locs
+}
+
+// expandArea lists the provider's locations in every country of the area,
+// keeping only those inside the outline when the area is a region.
+func expandArea(p providers.Provider, area *utils.Area) []models.Location {
+	var locs []models.Location
+	for _, cc := range area.Countries {
+		expanded, err := p.GetLocationsByCountry(cc)
+		if err != nil {
+			fmt.Printf("Warning: skipping %s on %s (%v)\n", cc, p.Name(), err)
+			continue
+		}
+		for _, l := range expanded {
+			if area.Contains(l.Latitude, l.Longitude) {
+				locs = append(locs, l)
+			}
+		}
+	}
+	return locs
+}
+
+// reportMismatches warns when providers resolved the same query to different
+// canonical places, e.g. two different Frankfurts.
+func reportMismatches(role string, matches placeMatches) {
+	queries := make([]string, 0, len(matches))
+	for q := range matches {
+		queries = append(queries, q)
+	}
+	sort.Strings(queries)
+
+	for _, q := range queries {
+		byProvider := matches[q]
+		distinct := make(map[string]bool)
+		for _, p := range byProvider {
+			distinct[p.ID] = true
+		}
+		if len(distinct) < 2 {
+			continue
+		}
+		fmt.Printf("Warning: %s '%s' resolves to different places:\n", role, q)
+		provs := make([]string, 0, len(byProvider))
+		for prov := range byProvider {
+			provs = append(provs, prov)
+		}
+		sort.Strings(provs)
+		for _, prov := range provs {
+			pl := byProvider[prov]
+			fmt.Printf("  %-12s -> %s (%s) %.4f,%.4f\n", prov, pl.Name, pl.Country, pl.Latitude, pl.Longitude)
+		}
+	}
+}
+
+func uniqueLocations(locs []models.Location, exclude string) []models.Location {
+	seen := make(map[string]bool)
+	var out []models.Location
+	for _, l := range locs {
+		if l.ID == exclude || seen[l.ID] {
+			continue
+		}
+		seen[l.ID] = true
+		out = append(out, l)
+	}
+	return out
+}
+
+// searchPairs is searchAllPairs without trips that are sold out or short of
+// seats for the party.
+func searchPairs(pairs []searchPair, dates []time.Time, reg *places.Registry) []models.Trip {
+	return bookableTrips(searchAllPairs(pairs, dates, reg))
+}
+
+// seatsNeeded is --min-seats, or the party size when that is larger.
+func seatsNeeded() int {
+	return max(minSeatsArg, partySize())
+}
+
+// bookable reports whether a trip can take the party. Trips whose provider
+// does not report free seats are assumed to have enough.
+func bookable(t models.Trip) bool {
+	return !t.SoldOut && (!t.SeatsKnown || t.Seats >= seatsNeeded())
+}
+
+func bookableTrips(trips []models.Trip) []models.Trip {
+	var out []models.Trip
+	for _, t := range trips {
+		if bookable(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// reportAvailability tells, for every searched route without a bookable
+// trip, whether its trips were sold out or it does not run at all.
+func reportAvailability(pairs []searchPair, trips []models.Trip, reg *places.Registry) {
+	type routeTrips struct{ total, bookable int }
+	routes := make(map[string]*routeTrips)
+	for _, pair := range pairs {
+		key := reg.Add(pair.Provider.Name(), pair.From).Name + " -> " + reg.Add(pair.Provider.Name(), pair.To).Name
+		routes[key] = &routeTrips{}
+	}
+	for _, t := range trips {
+		if r := routes[t.OriginPlace+" -> "+t.DestinationPlace]; r != nil {
+			r.total++
+			if bookable(t) {
+				r.bookable++
+			}
+		}
+	}
+
+	var soldOut, notRunning []string
+	for key, r := range routes {
+		switch {
+		case r.total == 0:
+			notRunning = append(notRunning, key)
+		case r.bookable == 0:
+			soldOut = append(soldOut, fmt.Sprintf("%s (%d trips)", key, r.total))
+		}
+	}
+	sort.Strings(soldOut)
+	sort.Strings(notRunning)
+
+	if len(soldOut) > 0 {
+		fmt.Printf("\nSold out or fewer than %d seats left:\n", seatsNeeded())
+		for _, s := range soldOut {
+			fmt.Printf("  %s\n", s)
+		}
+	}
+	if len(notRunning) > 0 && len(notRunning) <= maxListedRoutes {
+		fmt.Println("\nNo trips running:")
+		for _, s := range notRunning {
+			fmt.Printf("  %s\n", s)
+		}
+	} else if len(notRunning) > 0 {
+		fmt.Printf("\nNo trips running on %d routes\n", len(notRunning))
+	}
+}
+
+// Routes without trips are listed by name up to maxListedRoutes, beyond that
+// only counted.
+const maxListedRoutes = 10
+
+// targetCurrency is the currency all prices are compared in.
+func targetCurrency() string {
+	if searchOpts.Currency == "" {
+		return "EUR"
+	}
+	return strings.ToUpper(searchOpts.Currency)
+}
+
+// missingRates records the currencies already warned about as having no rate.
+var (
+	missingRates   = make(map[string]bool)
+	missingRatesMu sync.Mutex
+)
+
+// convertTrip converts a trip priced in another currency with the rate
+// table, keeping the original price. It reports false for a currency
+// without a rate, whose prices cannot be compared with the others, and
+// warns about each such currency once.
+func convertTrip(t *models.Trip, target string) bool {
+	if t.Currency == "" || strings.EqualFold(t.Currency, target) {
+		return true
+	}
+	price, err := utils.Convert(t.Price, t.Currency, target)
+	if err != nil {
+		missingRatesMu.Lock()
+		if !missingRates[t.Currency] {
+			missingRates[t.Currency] = true
+			fmt.Printf("Warning: %v; skipping %s trips priced in %s (add the rate with --rates)\n", err, t.Provider, t.Currency)
+		}
+		missingRatesMu.Unlock()
+		return false
+	}
+	for i := range t.Fares {
+		t.Fares[i].Price, _ = utils.Convert(t.Fares[i].Price, t.Currency, target)
+	}
+	t.OriginalPrice, t.OriginalCurrency = t.Price, t.Currency
+	t.Price, t.Currency = price, target
+	return true
+}
+
+// segmentZones moves segment times into the zones of their stations: the
+// trip's own zones at its ends and the zones at the station coordinates in
+// between. Stations without coordinates take the trip's zone when it starts
+// and ends in the same one, and otherwise keep the offset of the API.
+func segmentZones(segs []models.Segment, depZone, arrZone *time.Location) {
+	for i := range segs {
+		s := &segs[i]
+		from := utils.TimeZoneAt("", s.OriginLatitude, s.OriginLongitude)
+		to := utils.TimeZoneAt("", s.DestinationLatitude, s.DestinationLongitude)
+		if depZone != nil && (i == 0 || from == nil && depZone == arrZone) {
+			from = depZone
+		}
+		if arrZone != nil && (i == len(segs)-1 || to == nil && depZone == arrZone) {
+			to = arrZone
+		}
+		if from != nil {
+			s.DepartureTime = s.DepartureTime.In(from)
+		}
+		if to != nil {
+			s.ArrivalTime = s.ArrivalTime.In(to)
+		}
+	}
+}
+
+// setupRates loads the rate table from --rates, or from ~/trips/rates.json
+// when present.
+func setupRates() {
+	path := ratesArg
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, "trips", "rates.json")
+		if _, err := os.Stat(path); err != nil {
+			return
+		}
+	}
+	if err := utils.LoadRates(path); err != nil {
+		fmt.Printf("Error: rates %s: %v\n", path, err)
+		os.Exit(1)
+	}
+}
+
+// searchAllPairs queries every pair on every date concurrently and tags the
+// resulting trips with their canonical places.
+func searchAllPairs(pairs []searchPair, dates []time.Time, reg *places.Registry) []models.Trip {
+	allTrips := []models.Trip{}
+	streamPairs(pairs, dates, reg, nil, func(trips []models.Trip) {
+		if len(trips) > 0 {
+			allTrips = append(allTrips, trips...)
+			fmt.Print(".")
+		}
+	})
+	return allTrips
+}
+
+// streamPairs runs the searches of searchAllPairs and hands the trips of
+// every finished query to found as soon as they are in, one call at a time.
+// Failed queries and ones without trips are reported with none. Closing stop
+// starts no further queries; a nil stop runs them all.
+func streamPairs(pairs []searchPair, dates []time.Time, reg *places.Registry, stop <-chan struct{}, found func([]models.Trip)) {
+	var tripMutex sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+
+queue:
+	for _, pair := range pairs {
+		for _, d := range dates {
+			select {
+			case <-stop:
+				break queue
+			case sem <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(pair searchPair, dt time.Time) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				trips, err := pair.Provider.SearchTrips(pair.From, pair.To, dt)
+				if err != nil {
+					utils.DebugLog("Error searching %s->%s: %v", pair.From.Name, pair.To.Name, err)
+					trips = nil
+				}
+
+				fromPlace := reg.Add(pair.Provider.Name(), pair.From)
+				toPlace := reg.Add(pair.Provider.Name(), pair.To)
+				depZone := utils.TimeZoneAt(pair.From.Country, pair.From.Latitude, pair.From.Longitude)
+				arrZone := utils.TimeZoneAt(pair.To.Country, pair.To.Latitude, pair.To.Longitude)
+				kept := trips[:0]
+				for _, t := range trips {
+					if !convertTrip(&t, targetCurrency()) {
+						continue
+					}
+
+					// APIs answer in the offset of their choice; station
+					// zones keep daylight saving and the day of travel right.
+					if depZone != nil {
+						t.DepartureTime = t.DepartureTime.In(depZone)
+					}
+					if arrZone != nil {
+						t.ArrivalTime = t.ArrivalTime.In(arrZone)
+					}
+					segmentZones(t.Segments, depZone, arrZone)
+					t.OriginPlace = fromPlace.Name
+					t.DestinationPlace = toPlace.Name
+					t.Distance = pair.To.Distance
+					kept = append(kept, t)
+				}
+				trips = kept
+
+				tripMutex.Lock()
+				found(trips)
+				tripMutex.Unlock()
+			}(pair, d)
+		}
+	}
+	wg.Wait()
+}
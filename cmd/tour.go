@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/places"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+var (
+	visitArg    string
+	nightsArg   int
+	startArg    string
+	optimizeArg string
+)
+
+var tourCmd = &cobra.Command{
+	Use:   "tour",
+	Short: "Plan a round trip visiting several cities",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetDebug(debugFlag)
+		setupGeocoder()
+		setupRates()
+		setupPassengers()
+		runTour()
+	},
+}
+
+func init() {
+	tourCmd.Flags().StringVarP(&fromArg, "from", "f", "", "Home city, where the tour starts and ends")
+	tourCmd.Flags().StringVar(&visitArg, "visit", "", "Cities to visit, comma separated")
+	tourCmd.Flags().IntVarP(&nightsArg, "nights", "n", 1, "Nights to stay in each city")
+	tourCmd.Flags().StringVar(&startArg, "start", "tomorrow", "Departure date of the first leg; with several dates the best of them is taken")
+	tourCmd.Flags().StringVar(&optimizeArg, "optimize", "price", "Optimize for: price, duration")
+	addSearchFlags(tourCmd)
+	tourCmd.MarkFlagRequired("from")
+	tourCmd.MarkFlagRequired("visit")
+	rootCmd.AddCommand(tourCmd)
+}
+
+// Up to tourExactMax stops every order is tried; beyond that a greedy tour is
+// improved by local search. tourMaxStops bounds the number of leg searches, which
+// grows with the cube of the stop count.
+const (
+	tourExactMax = 7
+	tourMaxStops = 10
+	greedySteps  = 10000
+)
+
+// legTable holds the best trip for every leg, indexed by position in the
+// tour and by origin and destination city. City 0 is home.
+type legTable struct {
+	trips [][][]*models.Trip
+}
+
+func newLegTable(n, cities int) *legTable {
+	lt := &legTable{trips: make([][][]*models.Trip, n+1)}
+	for pos := range lt.trips {
+		lt.trips[pos] = make([][]*models.Trip, cities)
+		for i := range lt.trips[pos] {
+			lt.trips[pos][i] = make([]*models.Trip, cities)
+		}
+	}
+	return lt
+}
+
+func (lt *legTable) get(pos, from, to int) *models.Trip {
+	return lt.trips[pos][from][to]
+}
+
+func tripCost(t *models.Trip) float64 {
+	if optimizeArg == "duration" {
+		return tripDuration(*t).Minutes()
+	}
+	return t.Price
+}
+
+func (lt *legTable) offer(pos, from, to int, t models.Trip) {
+	if cur := lt.trips[pos][from][to]; cur == nil || tripCost(&t) < tripCost(cur) {
+		lt.trips[pos][from][to] = &t
+	}
+}
+
+// cost sums the legs of a tour visiting order (without home) and returns
+// +Inf when some leg has no trip.
+func (lt *legTable) cost(order []int) float64 {
+	total, prev := 0.0, 0
+	for pos, city := range append(append([]int{}, order...), 0) {
+		t := lt.get(pos, prev, city)
+		if t == nil {
+			return math.Inf(1)
+		}
+		total += tripCost(t)
+		prev = city
+	}
+	return total
+}
+
+func runTour() {
+	if optimizeArg != "price" && optimizeArg != "duration" {
+		fmt.Printf("Unknown --optimize %s\n", optimizeArg)
+		os.Exit(1)
+	}
+	if nightsArg < 1 {
+		fmt.Println("Error: --nights must be at least 1")
+		os.Exit(1)
+	}
+	stops := splitList(visitArg)
+	if len(stops) == 0 || len(stops) > tourMaxStops {
+		fmt.Printf("Error: --visit needs 1 to %d cities\n", tourMaxStops)
+		os.Exit(1)
+	}
+	starts, err := utils.ParseDates(startArg)
+	if err != nil {
+		fmt.Printf("Date error: %v\n", err)
+		os.Exit(1)
+	}
+	pList := selectProviders(provArg)
+	if len(pList) == 0 {
+		fmt.Printf("Unknown provider: %s\n", provArg)
+		os.Exit(1)
+	}
+
+	cities := append([]string{fromArg}, stops...)
+	n := len(stops)
+
+	reg := places.NewRegistry(langArg)
+	res := newResolver(reg)
+	matches := make(placeMatches)
+	cityOf := make(map[string]int)
+	locsByProvider := make(map[string][][]models.Location)
+	for _, p := range pList {
+		byCity := make([][]models.Location, len(cities))
+		for i, c := range cities {
+			byCity[i] = uniqueLocations(resolveNames(p, "City", []string{c}, res, matches), "")
+			for _, l := range byCity[i] {
+				cityOf[reg.Add(p.Name(), l).Name] = i
+			}
+		}
+		locsByProvider[p.Name()] = byCity
+	}
+	reportMismatches("City", matches)
+
+	// Every start date gets its own leg table. Legs of different starts that
+	// fall on the same day share one search.
+	type tourLeg struct{ start, pos int }
+	tables := make([]*legTable, len(starts))
+	legsOn := make(map[time.Time][]tourLeg)
+	var days []time.Time
+	for si, start := range starts {
+		tables[si] = newLegTable(n, len(cities))
+		for pos := 0; pos <= n; pos++ {
+			day := start.AddDate(0, 0, pos*nightsArg)
+			if legsOn[day] == nil {
+				days = append(days, day)
+			}
+			legsOn[day] = append(legsOn[day], tourLeg{si, pos})
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	needed := func(day time.Time, from, to int) bool {
+		for _, l := range legsOn[day] {
+			if tourLegNeeded(l.pos, n, from, to) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, day := range days {
+		var pairs []searchPair
+		for _, p := range pList {
+			byCity := locsByProvider[p.Name()]
+			for from := range cities {
+				for to := range cities {
+					if !needed(day, from, to) {
+						continue
+					}
+					for _, fl := range byCity[from] {
+						for _, tl := range byCity[to] {
+							pairs = append(pairs, searchPair{Provider: p, From: fl, To: tl})
+						}
+					}
+				}
+			}
+		}
+		fmt.Printf("\nDay %d of %d, %s: searching %d pairs...\n", i+1, len(days), day.Format("02.01.2006"), len(pairs))
+		for _, t := range searchPairs(pairs, []time.Time{day}, reg) {
+			from, ok1 := cityOf[t.OriginPlace]
+			to, ok2 := cityOf[t.DestinationPlace]
+			if !ok1 || !ok2 {
+				continue
+			}
+			for _, l := range legsOn[day] {
+				if tourLegNeeded(l.pos, n, from, to) {
+					tables[l.start].offer(l.pos, from, to, t)
+				}
+			}
+		}
+	}
+	fmt.Println()
+
+	var order []int
+	var legs *legTable
+	bestCost := math.Inf(1)
+	for si, lt := range tables {
+		var o []int
+		if n <= tourExactMax {
+			o = bestOrderExact(lt, n)
+		} else {
+			o = bestOrderHeuristic(lt, n)
+		}
+		if o == nil {
+			utils.DebugLog("no complete tour starting %s", starts[si].Format("02.01.2006"))
+			continue
+		}
+		if c := lt.cost(o); c < bestCost {
+			order, legs, bestCost = o, lt, c
+		}
+	}
+	if order == nil {
+		fmt.Println("No complete itinerary found: some cities cannot be reached on the required dates.")
+		return
+	}
+	printTour(cities, order, legs)
+}
+
+// tourLegNeeded reports whether a leg from one city to another can occur at
+// a given position: the first leg leaves home, the last one returns there and
+// the ones in between connect two different stops.
+func tourLegNeeded(pos, n, from, to int) bool {
+	switch {
+	case from == to:
+		return false
+	case pos == 0:
+		return from == 0
+	case pos == n:
+		return to == 0
+	default:
+		return from != 0 && to != 0
+	}
+}
+
+// bestOrderExact tries every order, pruning partial tours that already cost
+// more than the best complete one.
+func bestOrderExact(legs *legTable, n int) []int {
+	var best []int
+	bestCost := math.Inf(1)
+	order := make([]int, 0, n)
+	used := make([]bool, n+1)
+
+	var visit func(cost float64)
+	visit = func(cost float64) {
+		if cost >= bestCost {
+			return
+		}
+		prev := 0
+		if len(order) > 0 {
+			prev = order[len(order)-1]
+		}
+		if len(order) == n {
+			if t := legs.get(n, prev, 0); t != nil && cost+tripCost(t) < bestCost {
+				bestCost = cost + tripCost(t)
+				best = append([]int{}, order...)
+			}
+			return
+		}
+		for city := 1; city <= n; city++ {
+			t := legs.get(len(order), prev, city)
+			if used[city] || t == nil {
+				continue
+			}
+			used[city] = true
+			order = append(order, city)
+			visit(cost + tripCost(t))
+			order = order[:len(order)-1]
+			used[city] = false
+		}
+	}
+	visit(0)
+	return best
+}
+
+// bestOrderHeuristic builds a greedy tour from every possible first stop and
+// improves the best of them with 2-opt segment reversals and single-stop
+// moves until neither helps.
+func bestOrderHeuristic(legs *legTable, n int) []int {
+	var best []int
+	bestCost := math.Inf(1)
+	for first := 1; first <= n; first++ {
+		order := greedyOrder(legs, n, first)
+		if order == nil {
+			continue
+		}
+		if c := legs.cost(order); c < bestCost {
+			best, bestCost = order, c
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < n-1; i++ {
+			for j := i + 1; j < n; j++ {
+				cand := append([]int{}, best...)
+				for a, b := i, j; a < b; a, b = a+1, b-1 {
+					cand[a], cand[b] = cand[b], cand[a]
+				}
+				if c := legs.cost(cand); c < bestCost {
+					best, bestCost, improved = cand, c, true
+				}
+			}
+		}
+		// Moving a single stop elsewhere catches what reversals miss.
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if i == j {
+					continue
+				}
+				rest := append(append([]int{}, best[:i]...), best[i+1:]...)
+				cand := append(append(append([]int{}, rest[:j]...), best[i]), rest[j:]...)
+				if c := legs.cost(cand); c < bestCost {
+					best, bestCost, improved = cand, c, true
+				}
+			}
+		}
+	}
+	return best
+}
+
+// greedyOrder starts at first and always takes the cheapest next leg to an
+// unvisited stop. At a dead end it backs up and tries the next cheapest leg,
+// giving up after greedySteps steps.
+func greedyOrder(legs *legTable, n, first int) []int {
+	if legs.get(0, 0, first) == nil {
+		return nil
+	}
+	order := []int{first}
+	used := map[int]bool{first: true}
+	steps := 0
+
+	var extend func() bool
+	extend = func() bool {
+		prev := order[len(order)-1]
+		if len(order) == n {
+			return legs.get(n, prev, 0) != nil
+		}
+		if steps++; steps > greedySteps {
+			return false
+		}
+		var next []int
+		for city := 1; city <= n; city++ {
+			if !used[city] && legs.get(len(order), prev, city) != nil {
+				next = append(next, city)
+			}
+		}
+		sort.Slice(next, func(i, j int) bool {
+			return tripCost(legs.get(len(order), prev, next[i])) < tripCost(legs.get(len(order), prev, next[j]))
+		})
+		for _, city := range next {
+			used[city] = true
+			order = append(order, city)
+			if extend() {
+				return true
+			}
+			order = order[:len(order)-1]
+			used[city] = false
+		}
+		return false
+	}
+	if !extend() {
+		return nil
+	}
+	return order
+}
+
+func printTour(cities []string, order []int, legs *legTable) {
+	fmt.Printf("\n--- Tour: %d stops, %d nights each ---\n", len(order), nightsArg)
+	fmt.Printf("%-3s | %-12s | %-12s | %-8s | %-10s | %-8s | %-20s -> %s\n", "#", "Dep", "Arr", "Dur", "Provider", "Price", "From", "To")
+
+	var total float64
+	var travel time.Duration
+	currency := ""
+	prev := 0
+	for pos, city := range append(append([]int{}, order...), 0) {
+		t := legs.get(pos, prev, city)
+		fmt.Printf("%-3d | %-12s | %-12s | %-8s | %-10s | %6.2f%s | %-20s -> %s\n",
+			pos+1,
+			t.DepartureTime.Format("02.01 15:04"),
+			t.ArrivalTime.Format("02.01 15:04"),
+			formatDuration(tripDuration(*t)),
+			t.Provider, t.Price, t.Currency,
+			t.OriginStation, t.DestinationStation)
+		if city != 0 {
+			fmt.Printf("    %d nights in %s\n", nightsArg, cities[city])
+		}
+		total += t.Price
+		travel += tripDuration(*t)
+		currency = t.Currency
+		prev = city
+	}
+	fmt.Printf("\nTotal: %.2f%s, %s on the road\n", total, currency, formatDuration(travel))
+}
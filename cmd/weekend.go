@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/places"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+var (
+	maxPriceArg  float64
+	weeksArg     int
+	departArg    string
+	returnArg    string
+	homeByArg    string
+	weekendRank  string
+	weekendShown int
+)
+
+var weekendCmd = &cobra.Command{
+	Use:   "weekend",
+	Short: "Find weekend getaways for the coming weeks",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.SetDebug(debugFlag)
+		setupGeocoder()
+		setupRates()
+		runWeekend()
+	},
+}
+
+func init() {
+	weekendCmd.Flags().StringVarP(&fromArg, "from", "f", "", "Home city or lat,lon")
+	weekendCmd.Flags().StringVarP(&toArg, "to", "t", "", "Destinations: cities, countries, groups or regions")
+	weekendCmd.Flags().IntVarP(&distArg, "distance", "D", 0, "Search destinations within X km of home")
+	weekendCmd.Flags().IntVar(&minDist, "min-distance", 0, "With --distance, skip destinations closer than X km")
+	weekendCmd.Flags().Float64Var(&maxPriceArg, "max-price", 0, "Maximum price of outbound and return together for all passengers (0 for no limit)")
+	weekendCmd.Flags().IntVar(&weeksArg, "weeks", 4, "Number of upcoming weekends to search")
+	weekendCmd.Flags().StringVar(&departArg, "depart", "fri 16:00-23:59,sat 05:00-11:00", "Outbound departure windows")
+	weekendCmd.Flags().StringVar(&returnArg, "return", "sun 12:00-21:00", "Return departure windows")
+	weekendCmd.Flags().StringVar(&homeByArg, "home-by", "", "Latest return arrival, e.g. \"sun 23:59\" or \"mon 01:00\"")
+	weekendCmd.Flags().StringVar(&weekendRank, "rank", "price", "Rank by: price, hours")
+	weekendCmd.Flags().IntVar(&weekendShown, "top", 10, "Destinations to show per weekend")
+	addSearchFlags(weekendCmd)
+	weekendCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(weekendCmd)
+}
+
+// getaway is the best outbound and return pair to one place on one weekend.
+type getaway struct {
+	Place    string
+	Outbound models.Trip
+	Return   models.Trip
+}
+
+func (g getaway) total() float64 { return g.Outbound.Price + g.Return.Price }
+
+// hours is the time spent at the destination.
+func (g getaway) hours() float64 { return g.Return.DepartureTime.Sub(g.Outbound.ArrivalTime).Hours() }
+
+func getawayLess(a, b getaway) bool {
+	if weekendRank == "hours" && a.hours() != b.hours() {
+		return a.hours() > b.hours()
+	}
+	if a.total() != b.total() {
+		return a.total() < b.total()
+	}
+	return a.hours() > b.hours()
+}
+
+// weekendDay returns the date of a weekday within the weekend around friday,
+// from the Tuesday before to the Monday after.
+func weekendDay(friday time.Time, day time.Weekday) time.Time {
+	offset := (int(day) - int(time.Friday) + 7) % 7
+	if offset > 3 {
+		offset -= 7
+	}
+	return friday.AddDate(0, 0, offset)
+}
+
+// currentFriday returns the Friday of the weekend today belongs to: the
+// coming one from Monday to Friday and the one just past on the weekend
+// itself, so that a search on Saturday still covers that weekend.
+func currentFriday(today time.Time) time.Time {
+	offset := (int(time.Friday) - int(today.Weekday()) + 7) % 7
+	if offset > 4 {
+		offset -= 7
+	}
+	return today.AddDate(0, 0, offset)
+}
+
+// windowDates returns the dates of a weekend on which the windows start,
+// leaving out those before today.
+func windowDates(friday time.Time, windows []utils.TimeWindow, today time.Time) []time.Time {
+	seen := make(map[time.Time]bool)
+	var dates []time.Time
+	for _, w := range windows {
+		if d := weekendDay(friday, w.Day); !seen[d] && !d.Before(today) {
+			seen[d] = true
+			dates = append(dates, d)
+		}
+	}
+	return dates
+}
+
+func runWeekend() {
+	if weekendRank != "price" && weekendRank != "hours" {
+		fmt.Printf("Unknown --rank %s\n", weekendRank)
+		os.Exit(1)
+	}
+	if weeksArg < 1 {
+		fmt.Println("Error: --weeks must be at least 1")
+		os.Exit(1)
+	}
+	if toArg == "" && distArg == 0 {
+		fmt.Println("Error: --to or --distance required")
+		os.Exit(1)
+	}
+	if minDist > 0 && minDist >= distArg {
+		fmt.Println("Error: --min-distance must be smaller than --distance")
+		os.Exit(1)
+	}
+	departWindows, err := utils.ParseTimeWindows(departArg)
+	if err == nil && len(departWindows) == 0 {
+		err = fmt.Errorf("--depart is empty")
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	returnWindows, err := utils.ParseTimeWindows(returnArg)
+	if err == nil && len(returnWindows) == 0 {
+		err = fmt.Errorf("--return is empty")
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	homeByDay, homeByMin := time.Sunday, -1
+	if homeByArg != "" {
+		homeByDay, homeByMin, err = utils.ParseWeekdayClock(homeByArg)
+		if err != nil {
+			fmt.Printf("Error: --home-by: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	setupPassengers()
+	pList := selectProviders(provArg)
+	if len(pList) == 0 {
+		fmt.Printf("Unknown provider: %s\n", provArg)
+		os.Exit(1)
+	}
+
+	reg := places.NewRegistry(langArg)
+	res := newResolver(reg)
+	originMatches := make(placeMatches)
+	destMatches := make(placeMatches)
+
+	var outPairs, retPairs []searchPair
+	homePlaces := make(map[string]bool)
+	for _, p := range pList {
+		fmt.Printf("\n--- Destinations on %s ---\n", p.Name())
+		froms := uniqueLocations(resolveNames(p, "Origin", splitList(fromArg), res, originMatches), "")
+		var toLocs []models.Location
+		if distArg == 0 {
+			toLocs = resolveNames(p, "Destination", splitList(toArg), res, destMatches)
+		}
+		for _, from := range froms {
+			homePlaces[reg.Add(p.Name(), from).Name] = true
+			dests := toLocs
+			if distArg > 0 {
+				lat, lon, err := res.center(p, from)
+				if err != nil {
+					fmt.Printf("Warning: no coordinates for %s (%v)\n", from.Name, err)
+					continue
+				}
+				dests, err = p.SearchLocationsByDistance(lat, lon, float64(minDist), float64(distArg))
+				if err != nil {
+					utils.DebugLog("Distance search error: %v", err)
+				}
+				for _, l := range dests {
+					reg.Add(p.Name(), l)
+				}
+			}
+			for _, dest := range uniqueLocations(dests, from.ID) {
+				outPairs = append(outPairs, searchPair{Provider: p, From: from, To: dest})
+				retPairs = append(retPairs, searchPair{Provider: p, From: dest, To: from})
+			}
+		}
+	}
+	reportMismatches("Origin", originMatches)
+	reportMismatches("Destination", destMatches)
+
+	today, _ := utils.ParseDates("today")
+	friday := currentFriday(today[0])
+	var fridays, outDates, retDates []time.Time
+	for w := 0; w < weeksArg; w++ {
+		f := friday.AddDate(0, 0, 7*w)
+		fridays = append(fridays, f)
+		outDates = append(outDates, windowDates(f, departWindows, today[0])...)
+		retDates = append(retDates, windowDates(f, returnWindows, today[0])...)
+	}
+
+	fmt.Printf("\nSearching %d outbound and %d return pairs over %d weekends...\n", len(outPairs), len(retPairs), weeksArg)
+	outbound := searchPairs(outPairs, outDates, reg)
+	returns := searchPairs(retPairs, retDates, reg)
+	fmt.Println()
+
+	for _, f := range fridays {
+		var deadline time.Time
+		if homeByMin >= 0 {
+			deadline = weekendDay(f, homeByDay).Add(time.Duration(homeByMin)*time.Minute + 59*time.Second)
+		}
+		printWeekend(f, bestGetaways(f, outbound, returns, departWindows, returnWindows, deadline, homePlaces))
+	}
+}
+
+// bestGetaways pairs every outbound trip of the weekend around friday with
+// every later return from the same place that arrives home by the deadline,
+// if any, and keeps the best pair per place within --max-price.
+func bestGetaways(friday time.Time, outbound, returns []models.Trip, departWindows, returnWindows []utils.TimeWindow, deadline time.Time, home map[string]bool) []getaway {
+	inWeekend := func(t time.Time) bool {
+		return !t.Before(friday.AddDate(0, 0, -3)) && t.Before(friday.AddDate(0, 0, 4))
+	}
+
+	returnsByPlace := make(map[string][]models.Trip)
+	for _, r := range returns {
+		if !home[r.DestinationPlace] || !inWeekend(r.DepartureTime) || !utils.InWindows(r.DepartureTime, returnWindows) {
+			continue
+		}
+		if !deadline.IsZero() && r.ArrivalTime.After(deadline) {
+			continue
+		}
+		returnsByPlace[r.OriginPlace] = append(returnsByPlace[r.OriginPlace], r)
+	}
+
+	best := make(map[string]getaway)
+	for _, o := range outbound {
+		if !inWeekend(o.DepartureTime) || !utils.InWindows(o.DepartureTime, departWindows) {
+			continue
+		}
+		for _, r := range returnsByPlace[o.DestinationPlace] {
+			if !r.DepartureTime.After(o.ArrivalTime) {
+				continue
+			}
+			g := getaway{Place: o.DestinationPlace, Outbound: o, Return: r}
+			if maxPriceArg > 0 && g.total() > maxPriceArg {
+				continue
+			}
+			if cur, ok := best[g.Place]; !ok || getawayLess(g, cur) {
+				best[g.Place] = g
+			}
+		}
+	}
+
+	list := make([]getaway, 0, len(best))
+	for _, g := range best {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return getawayLess(list[i], list[j]) })
+	return list
+}
+
+func printWeekend(friday time.Time, getaways []getaway) {
+	fmt.Printf("\n--- Weekend %s - %s: %d destinations ---\n",
+		friday.Format("Mon 02.01"), friday.AddDate(0, 0, 2).Format("Mon 02.01"), len(getaways))
+	if len(getaways) == 0 {
+		return
+	}
+	fmt.Printf("%-25s | %-8s | %-5s | %-31s | %s\n", "Destination", "Total", "Hours", "Outbound", "Return")
+	for i, g := range getaways {
+		if i == weekendShown {
+			break
+		}
+		fmt.Printf("%-25s | %8.2f | %5.0f | %s | %s\n", g.Place, g.total(), g.hours(), describeLeg(g.Outbound), describeLeg(g.Return))
+	}
+}
+
+func describeLeg(t models.Trip) string {
+	return fmt.Sprintf("%s %s-%s %-10s %6.2f",
+		t.DepartureTime.Format("Mon"), t.DepartureTime.Format("15:04"), t.ArrivalTime.Format("15:04"), t.Provider, t.Price)
+}
@@ -2,23 +2,95 @@ package models
 
 import "time"
 
+const (
+	LocationCity    = "city"
+	LocationStation = "station"
+)
+
+const (
+	PassengerAdult   = "adult"
+	PassengerChild   = "child"
+	PassengerSenior  = "senior"
+	PassengerStudent = "student"
+)
+
+// Passenger is one traveller. Age is always set, for adults, seniors and
+// students to a typical age of the category.
+type Passenger struct {
+	Type string
+	Age  int
+}
+
+// Fare is one seat class of a trip with its own price and free seats.
+type Fare struct {
+	Class      string
+	Price      float64
+	Seats      int
+	SeatsKnown bool
+}
+
+// Segment is one vehicle ride of a trip with transfers.
+type Segment struct {
+	OriginStation      string
+	DestinationStation string
+	DepartureTime      time.Time
+	ArrivalTime        time.Time
+	VehicleType        string
+	// Station coordinates, when the provider reports them, place the
+	// segment times in the zones of stations along the way.
+	OriginLatitude       float64
+	OriginLongitude      float64
+	DestinationLatitude  float64
+	DestinationLongitude float64
+}
+
 type Location struct {
 	ID        string
 	Name      string
 	Country   string
 	Latitude  float64
 	Longitude float64
+	Type      string
+	Score     float64
+	// Distance is the great-circle distance in km from the centre of a
+	// radius search; zero for locations found any other way.
+	Distance float64
 }
 
+// Trip times are in the local time zone of the departure and arrival
+// stations.
 type Trip struct {
-	Provider           string
-	DepartureTime      time.Time
-	ArrivalTime        time.Time
-	Duration           string
+	Provider      string
+	DepartureTime time.Time
+	ArrivalTime   time.Time
+	Duration      string
+	// Price is the total for all passengers of the search.
 	Price              float64
 	Currency           string
 	OriginStation      string
 	DestinationStation string
 	Transfers          int
 	VehicleType        string
+	OriginPlace        string
+	DestinationPlace   string
+	Distance           float64
+	// Seats is the number of free seats when SeatsKnown is set; providers
+	// that do not report seats leave both zero. SoldOut marks trips that run
+	// but cannot be booked.
+	Seats      int
+	SeatsKnown bool
+	SoldOut    bool
+	// Fares lists the seat classes when the provider was asked for them.
+	// Providers may instead return one trip per class, each with its class
+	// as the only fare and its price.
+	Fares     []Fare
+	Amenities []string
+	// Segments lists the rides of the trip when the provider reports them.
+	Segments []Segment
+	// OriginalPrice and OriginalCurrency keep the provider's price when it
+	// was converted to another currency.
+	OriginalPrice    float64
+	OriginalCurrency string
+	// BookingURL opens the provider's checkout or search for this trip.
+	BookingURL string
 }
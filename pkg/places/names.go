@@ -0,0 +1,147 @@
+package places
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+//go:embed data/names.json
+var namesJSON []byte
+
+// NamedPlace is an entry of the embedded multilingual name dataset. Names are
+// keyed by ISO 639-1 language code; Local is the language of the endonym.
+type NamedPlace struct {
+	ID        string            `json:"id"`
+	Country   string            `json:"country"`
+	Latitude  float64           `json:"lat"`
+	Longitude float64           `json:"lon"`
+	Local     string            `json:"local"`
+	Names     map[string]string `json:"names"`
+	Aliases   []string          `json:"aliases"`
+}
+
+// Named places are matched to provider locations only when this close.
+const namedPlaceRadiusKm = 15.0
+
+var (
+	namedOnce   sync.Once
+	namedPlaces []*NamedPlace
+	namedByKey  map[string]*NamedPlace
+)
+
+func loadNamed() {
+	namedOnce.Do(func() {
+		if err := json.Unmarshal(namesJSON, &namedPlaces); err != nil {
+			utils.DebugLog("Places: failed to load name dataset: %v", err)
+			return
+		}
+		namedByKey = make(map[string]*NamedPlace)
+		for _, p := range namedPlaces {
+			for _, n := range p.allNames() {
+				if k := utils.NormalizeName(n); k != "" {
+					if _, taken := namedByKey[k]; !taken {
+						namedByKey[k] = p
+					}
+				}
+			}
+		}
+	})
+}
+
+func (n *NamedPlace) allNames() []string {
+	langs := make([]string, 0, len(n.Names))
+	for lang := range n.Names {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	names := make([]string, 0, len(langs)+len(n.Aliases))
+	for _, lang := range langs {
+		names = append(names, n.Names[lang])
+	}
+	return append(names, n.Aliases...)
+}
+
+// ResolveName maps any known name, exonym or alias ("Wien", "Vídeň",
+// "Pressburg") to its place.
+func ResolveName(query string) *NamedPlace {
+	loadNamed()
+	return namedByKey[utils.NormalizeName(query)]
+}
+
+// Name returns the place name in the given language, falling back to English
+// and then to the endonym.
+func (n *NamedPlace) Name(lang string) string {
+	if name, ok := n.Names[strings.ToLower(lang)]; ok {
+		return name
+	}
+	if name, ok := n.Names["en"]; ok {
+		return name
+	}
+	return n.Names[n.Local]
+}
+
+// QueryNames lists the names worth trying against a provider, most widely
+// understood first.
+func (n *NamedPlace) QueryNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append([]string{n.Names["en"], n.Names[n.Local]}, n.allNames()...) {
+		k := utils.NormalizeName(name)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// Near reports whether a provider location lies at this place. Locations
+// without coordinates are accepted on country alone.
+func (n *NamedPlace) Near(loc models.Location) bool {
+	if loc.Country != "" && !strings.EqualFold(loc.Country, n.Country) {
+		return false
+	}
+	if !hasCoords(loc.Latitude, loc.Longitude) {
+		return true
+	}
+	return utils.HaversineDistance(n.Latitude, n.Longitude, loc.Latitude, loc.Longitude) <= namedPlaceRadiusKm
+}
+
+// LookupLocation finds the named place a provider location belongs to, by
+// its name with or without station words, or failing that by proximity.
+func LookupLocation(loc models.Location) *NamedPlace {
+	for _, name := range []string{loc.Name, strings.Join(nameTokens(loc.Name), " ")} {
+		if p := ResolveName(name); p != nil && p.Near(loc) {
+			return p
+		}
+	}
+	if !hasCoords(loc.Latitude, loc.Longitude) {
+		return nil
+	}
+
+	var best *NamedPlace
+	bestDist := namedPlaceRadiusKm
+	for _, p := range namedPlaces {
+		if d := utils.HaversineDistance(p.Latitude, p.Longitude, loc.Latitude, loc.Longitude); d <= bestDist {
+			best, bestDist = p, d
+		}
+	}
+	return best
+}
+
+// LocalizedName translates a known place name into the given language and
+// returns unknown names unchanged.
+func LocalizedName(name, lang string) string {
+	if p := ResolveName(name); p != nil {
+		return p.Name(lang)
+	}
+	return name
+}
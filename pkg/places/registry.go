@@ -0,0 +1,231 @@
+package places
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/utils"
+)
+
+// Place is a city as seen across providers, with each provider's own
+// location attached.
+type Place struct {
+	ID        string
+	Name      string
+	Country   string
+	Latitude  float64
+	Longitude float64
+	Locations map[string]models.Location
+
+	named *NamedPlace
+}
+
+type Registry struct {
+	mu     sync.Mutex
+	lang   string
+	places []*Place
+	byID   map[string]*Place
+	byLoc  map[string]*Place
+}
+
+const (
+	// Locations with compatible names merge within this distance.
+	mergeRadiusKm = 30.0
+	// Locations this close merge even when their names differ (Wien/Vienna).
+	sameSpotKm = 5.0
+)
+
+// Words that name a station rather than a city, ignored when comparing names.
+var stationWords = map[string]bool{
+	"hbf": true, "hauptbahnhof": true, "hl": true, "n": true, "hlavni": true,
+	"nadrazi": true, "bus": true, "station": true, "central": true,
+	"centraal": true, "centrum": true, "main": true, "sbb": true, "hb": true,
+	"zob": true, "am": true, "im": true, "an": true, "der": true,
+}
+
+// NewRegistry creates an empty registry naming known places in lang.
+func NewRegistry(lang string) *Registry {
+	return &Registry{
+		lang:  lang,
+		byID:  make(map[string]*Place),
+		byLoc: make(map[string]*Place),
+	}
+}
+
+func locKey(provider, id string) string { return provider + "|" + id }
+
+func nameTokens(name string) []string {
+	var tokens []string
+	for _, t := range strings.Fields(utils.NormalizeName(name)) {
+		if !stationWords[t] {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+func namesMatch(a, b string) bool {
+	ta, tb := nameTokens(a), nameTokens(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return false
+	}
+	return ta[0] == tb[0]
+}
+
+func hasCoords(lat, lon float64) bool { return lat != 0 || lon != 0 }
+
+// Matches reports whether a provider location belongs to this place.
+func (p *Place) Matches(loc models.Location) bool {
+	return p.matches(loc, LookupLocation(loc))
+}
+
+// matches is Matches with the location's named place already looked up.
+func (p *Place) matches(loc models.Location, named *NamedPlace) bool {
+	if p.Country != "" && loc.Country != "" && !strings.EqualFold(p.Country, loc.Country) {
+		return false
+	}
+	if p.named != nil && p.named == named {
+		return true
+	}
+	if hasCoords(p.Latitude, p.Longitude) && hasCoords(loc.Latitude, loc.Longitude) {
+		dist := utils.HaversineDistance(p.Latitude, p.Longitude, loc.Latitude, loc.Longitude)
+		if dist <= sameSpotKm {
+			return true
+		}
+		return dist <= mergeRadiusKm && namesMatch(p.Name, loc.Name)
+	}
+	return utils.NormalizeName(p.Name) == utils.NormalizeName(loc.Name)
+}
+
+// Add attaches a provider location to the place it belongs to, creating a new
+// place when none matches. Adding the same location twice is a no-op.
+func (r *Registry) Add(provider string, loc models.Location) *Place {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := locKey(provider, loc.ID)
+	if p, ok := r.byLoc[key]; ok {
+		return p
+	}
+
+	named := LookupLocation(loc)
+	for _, p := range r.places {
+		if _, taken := p.Locations[provider]; taken && p.Locations[provider].ID != loc.ID {
+			continue
+		}
+		if p.matches(loc, named) {
+			p.Locations[provider] = loc
+			if p.Country == "" {
+				p.Country = strings.ToUpper(loc.Country)
+			}
+			if !hasCoords(p.Latitude, p.Longitude) {
+				p.Latitude, p.Longitude = loc.Latitude, loc.Longitude
+			}
+			r.byLoc[key] = p
+			return p
+		}
+	}
+
+	p := &Place{
+		Name:      loc.Name,
+		Country:   strings.ToUpper(loc.Country),
+		Latitude:  loc.Latitude,
+		Longitude: loc.Longitude,
+		Locations: map[string]models.Location{provider: loc},
+		named:     named,
+	}
+	if p.named != nil {
+		p.Name = p.named.Name(r.lang)
+		if p.Country == "" {
+			p.Country = p.named.Country
+		}
+	}
+	r.insert(p, provider)
+	r.byLoc[key] = p
+	return p
+}
+
+// Named returns the place of a known name, creating it before any provider
+// location is attached, so every provider is steered to the same city.
+func (r *Registry) Named(n *NamedPlace) *Place {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.places {
+		if p.named == n {
+			return p
+		}
+	}
+	p := &Place{
+		Name:      n.Name(r.lang),
+		Country:   n.Country,
+		Latitude:  n.Latitude,
+		Longitude: n.Longitude,
+		Locations: make(map[string]models.Location),
+		named:     n,
+	}
+	r.insert(p, "")
+	return p
+}
+
+// insert registers a new place, telling it apart from an existing place of
+// the same name by country, else by coordinates, else by provider.
+func (r *Registry) insert(p *Place, provider string) {
+	p.ID = r.uniqueID(p)
+	for _, other := range r.places {
+		if other.Name != p.Name {
+			continue
+		}
+		switch {
+		case p.Country != "":
+			p.Name = fmt.Sprintf("%s (%s)", p.Name, p.Country)
+		case hasCoords(p.Latitude, p.Longitude):
+			p.Name = fmt.Sprintf("%s (%.2f, %.2f)", p.Name, p.Latitude, p.Longitude)
+		case provider != "":
+			p.Name = fmt.Sprintf("%s (%s)", p.Name, provider)
+		}
+		break
+	}
+	r.places = append(r.places, p)
+	r.byID[p.ID] = p
+}
+
+func (r *Registry) uniqueID(p *Place) string {
+	base := strings.ReplaceAll(utils.NormalizeName(p.Name), " ", "-")
+	if p.named != nil {
+		base = p.named.ID
+	}
+	if p.Country != "" {
+		base += "-" + strings.ToLower(p.Country)
+	}
+	id := base
+	for i := 2; r.byID[id] != nil; i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+	return id
+}
+
+// Lookup returns the place a provider location was registered under.
+func (r *Registry) Lookup(provider, id string) *Place {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.byLoc[locKey(provider, id)]
+}
+
+func (r *Registry) Get(id string) *Place {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.byID[id]
+}
+
+func (r *Registry) Places() []*Place {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*Place, len(r.places))
+	copy(out, r.places)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,343 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/utils"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const blaBlaCarBusBaseURL = "https://bus-api.blablacar.com"
+
+// BlaBlaCarBusProvider talks to the BlaBlaCar Bus v3 API. The API key is read
+// from BLABLACAR_BUS_API_KEY when APIKey is empty; BaseURL can point at a local
+// stand-in serving recorded responses.
+type BlaBlaCarBusProvider struct {
+	BaseURL string
+	APIKey  string
+	Options Options
+
+	stops    []blaBlaCarStop
+	stopByID map[int]blaBlaCarStop
+	initOnce sync.Once
+	initErr  error
+}
+
+type blaBlaCarStop struct {
+	ID        int     `json:"id"`
+	ShortName string  `json:"short_name"`
+	LongName  string  `json:"long_name"`
+	TimeZone  string  `json:"time_zone"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	IsMeta    bool    `json:"is_meta_gare"`
+	Stops     []struct {
+		ID int `json:"id"`
+	} `json:"stops"`
+}
+
+// Stops carry no country, but every European time zone maps to one country.
+var blaBlaCarTimeZoneCountries = map[string]string{
+	"Europe/Paris": "FR", "Europe/Brussels": "BE", "Europe/Amsterdam": "NL",
+	"Europe/Luxembourg": "LU", "Europe/Berlin": "DE", "Europe/Madrid": "ES",
+	"Europe/Lisbon": "PT", "Europe/London": "GB", "Europe/Rome": "IT",
+	"Europe/Zurich": "CH", "Europe/Vienna": "AT", "Europe/Prague": "CZ",
+	"Europe/Warsaw": "PL", "Europe/Budapest": "HU", "Europe/Bratislava": "SK",
+	"Europe/Zagreb": "HR", "Europe/Ljubljana": "SI", "Europe/Copenhagen": "DK",
+	"Europe/Andorra": "AD", "Europe/Monaco": "MC",
+}
+
+func (b *BlaBlaCarBusProvider) Name() string { return "BlaBlaCar" }
+
+func (b *BlaBlaCarBusProvider) baseURL() string {
+	if b.BaseURL != "" {
+		return strings.TrimRight(b.BaseURL, "/")
+	}
+	return blaBlaCarBusBaseURL
+}
+
+func (b *BlaBlaCarBusProvider) newRequest(method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, b.baseURL()+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	key := b.APIKey
+	if key == "" {
+		key = os.Getenv("BLABLACAR_BUS_API_KEY")
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Token "+key)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (b *BlaBlaCarBusProvider) ensureData() error {
+	b.initOnce.Do(func() {
+		utils.DebugLog("BlaBlaCar: Fetching all stops...")
+		req, err := b.newRequest("GET", "/v3/stops", nil)
+		if err != nil {
+			b.initErr = err
+			return
+		}
+		client := http.Client{Timeout: 20 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			b.initErr = err
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			b.initErr = fmt.Errorf("api error %d", resp.StatusCode)
+			return
+		}
+
+		var result struct {
+			Stops []blaBlaCarStop `json:"stops"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			b.initErr = err
+			return
+		}
+
+		b.stopByID = make(map[int]blaBlaCarStop)
+		inMeta := make(map[int]bool)
+		for _, s := range result.Stops {
+			b.stopByID[s.ID] = s
+			for _, child := range s.Stops {
+				inMeta[child.ID] = true
+			}
+		}
+		// Meta stops group all stations of a city; stand-alone stops are kept
+		// only when no city groups them.
+		for _, s := range result.Stops {
+			if s.IsMeta || !inMeta[s.ID] {
+				b.stops = append(b.stops, s)
+			}
+		}
+	})
+	return b.initErr
+}
+
+func (s blaBlaCarStop) location() models.Location {
+	locType := models.LocationStation
+	if s.IsMeta {
+		locType = models.LocationCity
+	}
+	return models.Location{
+		ID:        strconv.Itoa(s.ID),
+		Name:      s.ShortName,
+		Country:   s.country(),
+		Latitude:  s.Latitude,
+		Longitude: s.Longitude,
+		Type:      locType,
+	}
+}
+
+// country maps the stop's time zone to a country, falling back to the country
+// outlines for zones shared by several countries or missing from the table.
+func (s blaBlaCarStop) country() string {
+	if cc, ok := blaBlaCarTimeZoneCountries[s.TimeZone]; ok {
+		return cc
+	}
+	return utils.CountryAt(s.Latitude, s.Longitude)
+}
+
+func (b *BlaBlaCarBusProvider) SearchLocationByName(name string) (*models.Location, error) {
+	return firstCandidate(b.SearchLocationCandidates(name))
+}
+
+func (b *BlaBlaCarBusProvider) SearchLocationCandidates(name string) ([]models.Location, error) {
+	if err := b.ensureData(); err != nil {
+		return nil, err
+	}
+	utils.DebugLog("BlaBlaCar: Stop search for '%s'", name)
+
+	var cands []models.Location
+	for _, s := range b.stops {
+		score := math.Max(utils.MatchScore(name, s.ShortName), utils.MatchScore(name, s.LongName))
+		if score == 0 {
+			continue
+		}
+		loc := s.location()
+		loc.Score = score
+		cands = append(cands, loc)
+	}
+	return rankCandidates(name, cands, utils.FuzzyMinScore), nil
+}
+
+func (b *BlaBlaCarBusProvider) GetLocationsByCountry(countryCode string) ([]models.Location, error) {
+	if err := b.ensureData(); err != nil {
+		return nil, err
+	}
+	var locs []models.Location
+	for _, s := range b.stops {
+		if strings.EqualFold(s.country(), countryCode) {
+			locs = append(locs, s.location())
+		}
+	}
+	return locs, nil
+}
+
+func (b *BlaBlaCarBusProvider) SearchLocationsByDistance(lat, lon, minKm, maxKm float64) ([]models.Location, error) {
+	if err := b.ensureData(); err != nil {
+		return nil, err
+	}
+	var locs []models.Location
+	for _, s := range b.stops {
+		loc := s.location()
+		if withinRing(&loc, lat, lon, minKm, maxKm) {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+func (b *BlaBlaCarBusProvider) stopName(id int) string {
+	if s, ok := b.stopByID[id]; ok {
+		if s.LongName != "" {
+			return s.LongName
+		}
+		return s.ShortName
+	}
+	return "Unknown"
+}
+
+type blaBlaCarFare struct {
+	OriginID      int    `json:"origin_id"`
+	DestinationID int    `json:"destination_id"`
+	Departure     string `json:"departure"`
+	Arrival       string `json:"arrival"`
+	PriceCents    int    `json:"price_cents"`
+	PriceCurrency string `json:"price_currency"`
+	Available     bool   `json:"available"`
+	Legs          []struct {
+		OriginID      int `json:"origin_id"`
+		DestinationID int `json:"destination_id"`
+	} `json:"legs"`
+}
+
+// fetchFares lists the fares departing on one calendar day.
+func (b *BlaBlaCarBusProvider) fetchFares(fromID, toID int, day time.Time, passengers []map[string]int) ([]blaBlaCarFare, error) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"origin_id":      fromID,
+		"destination_id": toID,
+		"date":           day.Format("2006-01-02"),
+		"currency":       "EUR",
+		"passengers":     passengers,
+	})
+	req, err := b.newRequest("POST", "/v3/fares", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("api error %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Fares []blaBlaCarFare `json:"fares"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return response.Fares, nil
+}
+
+func (b *BlaBlaCarBusProvider) SearchTrips(fromLoc, toLoc models.Location, date time.Time) ([]models.Trip, error) {
+	if err := b.ensureData(); err != nil {
+		return nil, err
+	}
+	fromID, err := strconv.Atoi(fromLoc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stop id %q", fromLoc.ID)
+	}
+	toID, err := strconv.Atoi(toLoc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stop id %q", toLoc.ID)
+	}
+
+	// Fares depend on age only; discount cards are not supported.
+	var passengers []map[string]int
+	for i, p := range b.Options.party() {
+		passengers = append(passengers, map[string]int{"id": i + 1, "age": p.Age})
+	}
+
+	// Rides after midnight are only listed under the next day.
+	var fares []blaBlaCarFare
+	seen := make(map[string]bool)
+	for _, day := range searchDays(date, b.Options.AfterMidnight) {
+		list, err := b.fetchFares(fromID, toID, day, passengers)
+		if err != nil {
+			return nil, err
+		}
+		for _, fare := range list {
+			key := fmt.Sprintf("%d|%d|%s", fare.OriginID, fare.DestinationID, fare.Departure)
+			if !seen[key] {
+				seen[key] = true
+				fares = append(fares, fare)
+			}
+		}
+	}
+
+	var trips []models.Trip
+	for _, fare := range fares {
+		depTime, err := time.Parse(time.RFC3339, fare.Departure)
+		if err != nil {
+			utils.DebugLog("BlaBlaCar: Error parsing time: %v", err)
+			continue
+		}
+		if !departsOn(depTime, date, b.Options.AfterMidnight) {
+			continue
+		}
+		arrTime, _ := time.Parse(time.RFC3339, fare.Arrival)
+
+		transfers := 0
+		if len(fare.Legs) > 1 {
+			transfers = len(fare.Legs) - 1
+		}
+		dur := arrTime.Sub(depTime)
+		currency := fare.PriceCurrency
+		if currency == "" {
+			currency = "EUR"
+		}
+
+		q := url.Values{}
+		q.Set("origin_id", strconv.Itoa(fare.OriginID))
+		q.Set("destination_id", strconv.Itoa(fare.DestinationID))
+		q.Set("date", depTime.Format("2006-01-02"))
+		q.Set("passengers", strconv.Itoa(len(passengers)))
+
+		trips = append(trips, models.Trip{
+			Provider:           "BlaBlaCar",
+			DepartureTime:      depTime,
+			ArrivalTime:        arrTime,
+			Duration:           fmt.Sprintf("%02dh %02dm", int(dur.Hours()), int(dur.Minutes())%60),
+			Price:              float64(fare.PriceCents) / 100,
+			Currency:           currency,
+			OriginStation:      b.stopName(fare.OriginID),
+			DestinationStation: b.stopName(fare.DestinationID),
+			Transfers:          transfers,
+			VehicleType:        "BUS",
+			SoldOut:            !fare.Available,
+			BookingURL:         "https://www.blablacar.com/bus/search?" + q.Encode(),
+		})
+	}
+	return trips, nil
+}
@@ -0,0 +1,153 @@
+package providers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuriiter/trips/pkg/models"
+)
+
+// blaBlaCarFares maps the date of a fare request to its recorded answer. Like
+// the API, each day lists only its own rides, apart from a stray one the day
+// before; other days have none.
+var blaBlaCarFares = map[string]string{
+	"2026-07-10": "blablacar_fares.json",
+	"2026-07-11": "blablacar_fares_2026-07-11.json",
+}
+
+// blaBlaCarStandIn serves the recorded stop list and fares and keeps the last
+// fare request and the dates of all of them.
+type blaBlaCarStandIn struct {
+	auth    string
+	request map[string]interface{}
+	dates   []string
+}
+
+func (s *blaBlaCarStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.auth = r.Header.Get("Authorization")
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/v3/stops":
+		serveFixture(w, "blablacar_stops.json")
+	case r.Method == "POST" && r.URL.Path == "/v3/fares":
+		if err := json.NewDecoder(r.Body).Decode(&s.request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		date, _ := s.request["date"].(string)
+		s.dates = append(s.dates, date)
+		name, ok := blaBlaCarFares[date]
+		if !ok {
+			w.Write([]byte(`{"fares": []}`))
+			return
+		}
+		serveFixture(w, name)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newBlaBlaCarStandIn(t *testing.T, opts Options) (*BlaBlaCarBusProvider, *blaBlaCarStandIn) {
+	t.Helper()
+	standIn := &blaBlaCarStandIn{}
+	srv := httptest.NewServer(standIn)
+	t.Cleanup(srv.Close)
+	return &BlaBlaCarBusProvider{BaseURL: srv.URL, APIKey: "test-key", Options: opts}, standIn
+}
+
+func TestBlaBlaCarStops(t *testing.T) {
+	p, standIn := newBlaBlaCarStandIn(t, Options{})
+
+	fr, err := p.GetLocationsByCountry("FR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Paris Bercy and La Défense are grouped by the Paris meta stop.
+	var names []string
+	for _, l := range fr {
+		names = append(names, l.Name)
+	}
+	if len(fr) != 2 || fr[0].Name != "Paris" || fr[1].Name != "Lyon Perrache" {
+		t.Fatalf("FR stops = %v, want [Paris Lyon Perrache]", names)
+	}
+	if fr[0].Type != models.LocationCity || fr[1].Type != models.LocationStation {
+		t.Errorf("types = %s, %s", fr[0].Type, fr[1].Type)
+	}
+	if standIn.auth != "Token test-key" {
+		t.Errorf("Authorization = %q", standIn.auth)
+	}
+
+	for id, want := range map[int]string{5: "IT", 6: "NO"} {
+		if got := p.stopByID[id].country(); got != want {
+			t.Errorf("stop %d country = %q, want %q", id, got, want)
+		}
+	}
+
+	cands, err := p.SearchLocationCandidates("Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cands) != 1 || cands[0].ID != "1" {
+		t.Errorf("Paris candidates = %+v, want only the meta stop", cands)
+	}
+}
+
+func TestBlaBlaCarSearchTrips(t *testing.T) {
+	p, standIn := newBlaBlaCarStandIn(t, Options{
+		Passengers: []models.Passenger{{Type: models.PassengerAdult, Age: 30}, {Type: models.PassengerChild, Age: 8}},
+	})
+	from := models.Location{ID: "1", Name: "Paris"}
+	to := models.Location{ID: "4", Name: "Lyon Perrache"}
+	trips, err := p.SearchTrips(from, to, time.Date(2026, 7, 10, 0, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := standIn.request["origin_id"]; got != 1.0 {
+		t.Errorf("origin_id = %v", got)
+	}
+	if pax, _ := standIn.request["passengers"].([]interface{}); len(pax) != 2 {
+		t.Errorf("passengers = %v", standIn.request["passengers"])
+	}
+
+	// The departure of the 9th is left out and the next day is not asked.
+	if len(standIn.dates) != 1 {
+		t.Errorf("fare requests for %v, want only the 10th", standIn.dates)
+	}
+	if len(trips) != 3 {
+		t.Fatalf("got %d trips, want 3 departing on the 10th", len(trips))
+	}
+	first := trips[0]
+	if first.Price != 19.99 || first.OriginStation != "Paris Bercy Seine" || first.Transfers != 0 || first.SoldOut {
+		t.Errorf("first trip = %+v", first)
+	}
+	if trips[1].Transfers != 1 {
+		t.Errorf("two-leg trip has %d transfers", trips[1].Transfers)
+	}
+	if late := trips[2]; !late.SoldOut || late.Price != 9.99 {
+		t.Errorf("unavailable fare = %+v, want it kept as sold out", late)
+	}
+}
+
+func TestBlaBlaCarSearchTripsAfterMidnight(t *testing.T) {
+	p, standIn := newBlaBlaCarStandIn(t, Options{AfterMidnight: 3 * time.Hour})
+	from := models.Location{ID: "1", Name: "Paris"}
+	to := models.Location{ID: "4", Name: "Lyon Perrache"}
+	trips, err := p.SearchTrips(from, to, time.Date(2026, 7, 10, 0, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The night ride is only listed under the 11th; its 09:00 ride is too late.
+	if got := strings.Join(standIn.dates, ","); got != "2026-07-10,2026-07-11" {
+		t.Errorf("fare requests for %s, want the 10th and 11th", got)
+	}
+	if len(trips) != 4 || trips[3].DepartureTime.Format("02 15:04") != "11 01:15" {
+		t.Fatalf("got %d trips, want the 01:15 night ride included", len(trips))
+	}
+	if !strings.Contains(trips[3].BookingURL, "date=2026-07-11") {
+		t.Errorf("night ride booking link = %s, want the day it departs", trips[3].BookingURL)
+	}
+}
@@ -0,0 +1,418 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/utils"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const deutscheBahnBaseURL = "https://int.bahn.de/web/api"
+
+// DeutscheBahnProvider talks to the bahn.de web API. BaseURL can point at a
+// local stand-in serving recorded responses.
+type DeutscheBahnProvider struct {
+	BaseURL string
+	Options Options
+}
+
+type dbStation struct {
+	EVA  string
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// Long-distance hubs used for country and radius expansion, the web API has
+// no endpoint listing all stations.
+var dbHubs = []dbStation{
+	{"8011160", "Berlin Hbf", 52.5251, 13.3694},
+	{"8000261", "München Hbf", 48.1402, 11.5600},
+	{"8002549", "Hamburg Hbf", 53.5530, 10.0069},
+	{"8000105", "Frankfurt(Main)Hbf", 50.1070, 8.6636},
+	{"8000207", "Köln Hbf", 50.9430, 6.9589},
+	{"8000096", "Stuttgart Hbf", 48.7843, 9.1818},
+	{"8000085", "Düsseldorf Hbf", 51.2199, 6.7943},
+	{"8010085", "Dresden Hbf", 51.0404, 13.7320},
+	{"8010205", "Leipzig Hbf", 51.3454, 12.3820},
+	{"8000152", "Hannover Hbf", 52.3766, 9.7410},
+	{"8000284", "Nürnberg Hbf", 49.4458, 11.0825},
+	{"8000050", "Bremen Hbf", 53.0830, 8.8137},
+	{"8000080", "Dortmund Hbf", 51.5178, 7.4593},
+	{"8000098", "Essen Hbf", 51.4513, 7.0137},
+	{"8000086", "Duisburg Hbf", 51.4297, 6.7756},
+	{"8000244", "Mannheim Hbf", 49.4794, 8.4699},
+	{"8000191", "Karlsruhe Hbf", 48.9935, 8.4020},
+	{"8000107", "Freiburg(Breisgau) Hbf", 47.9977, 7.8412},
+	{"8000309", "Regensburg Hbf", 49.0118, 12.0994},
+	{"8000298", "Passau Hbf", 48.5741, 13.4508},
+	{"8000013", "Augsburg Hbf", 48.3655, 10.8855},
+	{"8000260", "Würzburg Hbf", 49.8018, 9.9358},
+	{"8010101", "Erfurt Hbf", 50.9725, 11.0380},
+	{"8003200", "Kassel-Wilhelmshöhe", 51.3130, 9.4465},
+	{"8000263", "Münster(Westf)Hbf", 51.9566, 7.6350},
+	{"8000036", "Bielefeld Hbf", 52.0292, 8.5326},
+	{"8000199", "Kiel Hbf", 54.3146, 10.1318},
+	{"8010304", "Rostock Hbf", 54.0781, 12.1313},
+	{"8000237", "Lübeck Hbf", 53.8677, 10.6698},
+	{"8000044", "Bonn Hbf", 50.7320, 7.0970},
+	{"8000240", "Mainz Hbf", 50.0012, 8.2588},
+	{"8000250", "Wiesbaden Hbf", 50.0706, 8.2436},
+	{"8000323", "Saarbrücken Hbf", 49.2410, 6.9909},
+	{"8000170", "Ulm Hbf", 48.3994, 9.9827},
+	{"8000156", "Heidelberg Hbf", 49.4036, 8.6758},
+	{"8000128", "Göttingen", 51.5365, 9.9268},
+	{"8000001", "Aachen Hbf", 50.7678, 6.0913},
+	{"8010224", "Magdeburg Hbf", 52.1302, 11.6269},
+	{"8010159", "Halle(Saale)Hbf", 51.4774, 11.9870},
+	{"8012666", "Potsdam Hbf", 52.3918, 13.0667},
+	{"8100003", "Wien Hbf", 48.1852, 16.3763},
+	{"8100002", "Salzburg Hbf", 47.8131, 13.0457},
+	{"8100108", "Innsbruck Hbf", 47.2633, 11.4008},
+	{"8503000", "Zürich HB", 47.3782, 8.5402},
+	{"8500010", "Basel SBB", 47.5474, 7.5896},
+	{"8400058", "Amsterdam Centraal", 52.3789, 4.9003},
+	{"8814001", "Bruxelles-Midi", 50.8357, 4.3365},
+	{"5400014", "Praha hl.n.", 50.0831, 14.4353},
+	{"8700011", "Paris Est", 48.8767, 2.3590},
+	{"8600626", "København H", 55.6727, 12.5646},
+}
+
+// The first two digits of an EVA number are the UIC country code.
+var dbUICCountries = map[string]string{
+	"80": "DE", "81": "AT", "85": "CH", "54": "CZ", "51": "PL",
+	"87": "FR", "84": "NL", "88": "BE", "82": "LU", "86": "DK",
+	"83": "IT", "55": "HU", "56": "SK", "79": "SI", "78": "HR",
+	"74": "SE", "76": "NO",
+}
+
+func (d *DeutscheBahnProvider) Name() string { return "DeutscheBahn" }
+
+func (d *DeutscheBahnProvider) baseURL() string {
+	if d.BaseURL != "" {
+		return strings.TrimRight(d.BaseURL, "/")
+	}
+	return deutscheBahnBaseURL
+}
+
+func dbCountryByEVA(eva string) string {
+	if len(eva) < 2 {
+		return ""
+	}
+	return dbUICCountries[eva[:2]]
+}
+
+func (s dbStation) location() models.Location {
+	return models.Location{
+		ID:        s.EVA,
+		Name:      s.Name,
+		Country:   dbCountryByEVA(s.EVA),
+		Latitude:  s.Lat,
+		Longitude: s.Lon,
+		Type:      models.LocationStation,
+	}
+}
+
+func (d *DeutscheBahnProvider) SearchLocationByName(name string) (*models.Location, error) {
+	return firstCandidate(d.SearchLocationCandidates(name))
+}
+
+func (d *DeutscheBahnProvider) SearchLocationCandidates(name string) ([]models.Location, error) {
+	utils.DebugLog("DeutscheBahn: Location search for '%s'", name)
+	u := fmt.Sprintf("%s/reiseloesung/orte?suchbegriff=%s&typ=ALL&limit=10", d.baseURL(), url.QueryEscape(name))
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("api error %d", resp.StatusCode)
+	}
+
+	var list []struct {
+		ExtID string  `json:"extId"`
+		Name  string  `json:"name"`
+		Lat   float64 `json:"lat"`
+		Lon   float64 `json:"lon"`
+		Type  string  `json:"type"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var cands []models.Location
+	for _, l := range list {
+		if l.Type != "ST" || l.ExtID == "" {
+			continue
+		}
+		cands = append(cands, models.Location{
+			ID:        l.ExtID,
+			Name:      l.Name,
+			Country:   dbCountryByEVA(l.ExtID),
+			Latitude:  l.Lat,
+			Longitude: l.Lon,
+			Type:      models.LocationStation,
+			Score:     math.Max(0, 1-0.05*float64(len(cands))),
+		})
+	}
+	return rankCandidates(name, cands, 0), nil
+}
+
+func (d *DeutscheBahnProvider) GetLocationsByCountry(countryCode string) ([]models.Location, error) {
+	var locs []models.Location
+	for _, s := range dbHubs {
+		if strings.EqualFold(dbCountryByEVA(s.EVA), countryCode) {
+			locs = append(locs, s.location())
+		}
+	}
+	return locs, nil
+}
+
+func (d *DeutscheBahnProvider) SearchLocationsByDistance(lat, lon, minKm, maxKm float64) ([]models.Location, error) {
+	var locs []models.Location
+	for _, s := range dbHubs {
+		loc := s.location()
+		if withinRing(&loc, lat, lon, minKm, maxKm) {
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+type dbJourneyRequest struct {
+	AbfahrtsHalt            string        `json:"abfahrtsHalt"`
+	AnkunftsHalt            string        `json:"ankunftsHalt"`
+	AnfrageZeitpunkt        string        `json:"anfrageZeitpunkt"`
+	AnkunftSuche            string        `json:"ankunftSuche"`
+	Klasse                  string        `json:"klasse"`
+	Produktgattungen        []string      `json:"produktgattungen"`
+	Reisende                []dbTraveller `json:"reisende"`
+	SchnelleVerbindungen    bool          `json:"schnelleVerbindungen"`
+	SitzplatzOnly           bool          `json:"sitzplatzOnly"`
+	BikeCarriage            bool          `json:"bikeCarriage"`
+	ReservierungsKontingent bool          `json:"reservierungsKontingenteVorhanden"`
+	PagingReference         string        `json:"pagingReference,omitempty"`
+}
+
+type dbTraveller struct {
+	Typ            string           `json:"typ"`
+	Ermaessigungen []dbErmaessigung `json:"ermaessigungen"`
+	Alter          []string         `json:"alter"`
+	Anzahl         int              `json:"anzahl"`
+}
+
+type dbErmaessigung struct {
+	Art    string `json:"art"`
+	Klasse string `json:"klasse"`
+}
+
+type dbJourneyResponse struct {
+	Verbindungen []struct {
+		UmstiegsAnzahl        int `json:"umstiegsAnzahl"`
+		VerbindungsAbschnitte []struct {
+			AbfahrtsZeitpunkt string `json:"abfahrtsZeitpunkt"`
+			AnkunftsZeitpunkt string `json:"ankunftsZeitpunkt"`
+			AbfahrtsOrt       string `json:"abfahrtsOrt"`
+			AnkunftsOrt       string `json:"ankunftsOrt"`
+			Verkehrsmittel    struct {
+				Kategorie string `json:"kategorie"`
+				Name      string `json:"name"`
+				Typ       string `json:"typ"`
+			} `json:"verkehrsmittel"`
+		} `json:"verbindungsAbschnitte"`
+		AngebotsPreis *struct {
+			Betrag   float64 `json:"betrag"`
+			Waehrung string  `json:"waehrung"`
+		} `json:"angebotsPreis"`
+	} `json:"verbindungen"`
+	VerbindungReference struct {
+		Later string `json:"later"`
+	} `json:"verbindungReference"`
+}
+
+// Number of "later connections" pages fetched to cover a whole day.
+const dbMaxPages = 6
+
+func dbLocationID(loc models.Location) string {
+	return fmt.Sprintf("A=1@O=%s@L=%s@", loc.Name, loc.ID)
+}
+
+// travellers maps the party to DB traveller types. A BahnCard is applied to
+// everyone from six years on; younger children travel free.
+func (d *DeutscheBahnProvider) travellers() []dbTraveller {
+	var list []dbTraveller
+	for _, p := range d.Options.party() {
+		t := dbTraveller{
+			Typ:            "ERWACHSENER",
+			Ermaessigungen: []dbErmaessigung{{Art: "KEINE_ERMAESSIGUNG", Klasse: "KLASSENLOS"}},
+			Alter:          []string{},
+			Anzahl:         1,
+		}
+		switch {
+		case p.Age < 6:
+			t.Typ = "KLEINKIND"
+		case p.Age < 15:
+			t.Typ = "KIND"
+		case p.Age <= 26 && p.Type != models.PassengerAdult:
+			t.Typ = "JUGENDLICHER"
+		case p.Age >= 65:
+			t.Typ = "SENIOR"
+		}
+		if t.Typ != "ERWACHSENER" {
+			t.Alter = []string{strconv.Itoa(p.Age)}
+		}
+		if p.Age >= 6 {
+			if d.Options.hasCard("bahncard50") {
+				t.Ermaessigungen = []dbErmaessigung{{Art: "BAHNCARD50", Klasse: "KLASSE_2"}}
+			} else if d.Options.hasCard("bahncard25") {
+				t.Ermaessigungen = []dbErmaessigung{{Art: "BAHNCARD25", Klasse: "KLASSE_2"}}
+			}
+		}
+		list = append(list, t)
+	}
+	return list
+}
+
+func (d *DeutscheBahnProvider) SearchTrips(fromLoc, toLoc models.Location, date time.Time) ([]models.Trip, error) {
+	// Times come without offset, in local time at each station.
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		berlin = time.Local
+	}
+	depZone, arrZone := berlin, berlin
+	if z := utils.TimeZoneAt(fromLoc.Country, fromLoc.Latitude, fromLoc.Longitude); z != nil {
+		depZone = z
+	}
+	if z := utils.TimeZoneAt(toLoc.Country, toLoc.Latitude, toLoc.Longitude); z != nil {
+		arrZone = z
+	}
+	dateStr := date.Format("2006-01-02")
+
+	req := dbJourneyRequest{
+		AbfahrtsHalt:         dbLocationID(fromLoc),
+		AnkunftsHalt:         dbLocationID(toLoc),
+		AnfrageZeitpunkt:     dateStr + "T00:00:00",
+		AnkunftSuche:         "ABFAHRT",
+		Klasse:               "KLASSE_2",
+		Produktgattungen:     []string{"ICE", "EC_IC", "IR", "REGIONAL", "SBAHN", "BUS"},
+		Reisende:             d.travellers(),
+		SchnelleVerbindungen: true,
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	var trips []models.Trip
+	// Pages may overlap, so connections are told apart by their rides.
+	seenConn := make(map[string]bool)
+
+	for page := 0; page < dbMaxPages; page++ {
+		payload, _ := json.Marshal(req)
+		resp, err := client.Post(d.baseURL()+"/angebote/fahrplan", "application/json", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("api error %d", resp.StatusCode)
+		}
+
+		var response dbJourneyResponse
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		pastDate := false
+		for _, v := range response.Verbindungen {
+			if len(v.VerbindungsAbschnitte) == 0 {
+				continue
+			}
+			first := v.VerbindungsAbschnitte[0]
+			last := v.VerbindungsAbschnitte[len(v.VerbindungsAbschnitte)-1]
+
+			var key strings.Builder
+			for _, a := range v.VerbindungsAbschnitte {
+				key.WriteString(a.AbfahrtsZeitpunkt + "|" + a.Verkehrsmittel.Name + "|")
+			}
+			if seenConn[key.String()] {
+				continue
+			}
+			seenConn[key.String()] = true
+
+			depTime, err := time.ParseInLocation("2006-01-02T15:04:05", first.AbfahrtsZeitpunkt, depZone)
+			if err != nil {
+				utils.DebugLog("DeutscheBahn: Error parsing time: %v", err)
+				continue
+			}
+			if !departsOn(depTime, date, d.Options.AfterMidnight) {
+				if depTime.After(date) {
+					pastDate = true
+				}
+				continue
+			}
+			arrTime, _ := time.ParseInLocation("2006-01-02T15:04:05", last.AnkunftsZeitpunkt, arrZone)
+
+			if v.AngebotsPreis == nil {
+				utils.DebugLog("DeutscheBahn: No Sparpreis offer for %s departure", depTime.Format("15:04"))
+				continue
+			}
+
+			var categories []string
+			seen := make(map[string]bool)
+			for _, a := range v.VerbindungsAbschnitte {
+				cat := a.Verkehrsmittel.Kategorie
+				if a.Verkehrsmittel.Typ != "PUBLICTRANSPORT" || cat == "" || seen[cat] {
+					continue
+				}
+				seen[cat] = true
+				categories = append(categories, cat)
+			}
+
+			dur := arrTime.Sub(depTime)
+			currency := v.AngebotsPreis.Waehrung
+			if currency == "" {
+				currency = "EUR"
+			}
+
+			// The bahn.de search takes the same location IDs as the API.
+			q := url.Values{}
+			q.Set("sts", "true")
+			q.Set("so", fromLoc.Name)
+			q.Set("zo", toLoc.Name)
+			q.Set("soid", dbLocationID(fromLoc))
+			q.Set("zoid", dbLocationID(toLoc))
+			q.Set("hd", depTime.Format("2006-01-02T15:04:05"))
+			q.Set("kl", "2")
+
+			trips = append(trips, models.Trip{
+				Provider:           "DeutscheBahn",
+				DepartureTime:      depTime,
+				ArrivalTime:        arrTime,
+				Duration:           fmt.Sprintf("%02dh %02dm", int(dur.Hours()), int(dur.Minutes())%60),
+				Price:              v.AngebotsPreis.Betrag,
+				Currency:           currency,
+				OriginStation:      first.AbfahrtsOrt,
+				DestinationStation: last.AnkunftsOrt,
+				Transfers:          v.UmstiegsAnzahl,
+				VehicleType:        strings.Join(categories, ", "),
+				BookingURL:         "https://www.bahn.de/buchung/fahrplan/suche#" + q.Encode(),
+			})
+		}
+
+		if pastDate || response.VerbindungReference.Later == "" {
+			break
+		}
+		req.PagingReference = response.VerbindungReference.Later
+	}
+	return trips, nil
+}
@@ -0,0 +1,181 @@
+package providers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yuriiter/trips/pkg/models"
+)
+
+// dbPages maps the paging reference of a timetable request to its recorded
+// page. The second page repeats a connection of the first, the last one has
+// no later reference.
+var dbPages = map[string]string{
+	"":            "db_fahrplan_1.json",
+	"3|OF|MTµ14µ": "db_fahrplan_2.json",
+	"3|OF|MTµ15µ": "db_fahrplan_3.json",
+}
+
+// dbStandIn serves the recorded bahn.de responses.
+type dbStandIn struct {
+	mu       sync.Mutex
+	requests []dbJourneyRequest
+}
+
+func (s *dbStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/reiseloesung/orte":
+		serveFixture(w, "db_orte.json")
+	case "/angebote/fahrplan":
+		var req dbJourneyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+		page, ok := dbPages[req.PagingReference]
+		if !ok {
+			http.Error(w, "unknown paging reference", http.StatusBadRequest)
+			return
+		}
+		serveFixture(w, page)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func serveFixture(w http.ResponseWriter, name string) {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func newDBStandIn(t *testing.T) (*DeutscheBahnProvider, *dbStandIn) {
+	t.Helper()
+	standIn := &dbStandIn{}
+	srv := httptest.NewServer(standIn)
+	t.Cleanup(srv.Close)
+	return &DeutscheBahnProvider{BaseURL: srv.URL}, standIn
+}
+
+var (
+	dbBerlin = models.Location{ID: "8011160", Name: "Berlin Hbf", Country: "DE", Latitude: 52.5251, Longitude: 13.3694}
+	dbMunich = models.Location{ID: "8000261", Name: "München Hbf", Country: "DE", Latitude: 48.1402, Longitude: 11.5600}
+)
+
+func TestDeutscheBahnLocationCandidates(t *testing.T) {
+	p, _ := newDBStandIn(t)
+	cands, err := p.SearchLocationCandidates("Berlin Hbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cands) != 2 {
+		t.Fatalf("got %d candidates, want the 2 stations", len(cands))
+	}
+	if cands[0].ID != "8011160" || cands[0].Country != "DE" || cands[0].Type != models.LocationStation {
+		t.Errorf("first candidate = %+v", cands[0])
+	}
+}
+
+func TestDeutscheBahnSearchTrips(t *testing.T) {
+	p, standIn := newDBStandIn(t)
+	date := time.Date(2026, 7, 10, 0, 0, 0, 0, time.Local)
+	trips, err := p.SearchTrips(dbBerlin, dbMunich, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Paging follows the later reference and stops on the page without one.
+	if len(standIn.requests) != len(dbPages) {
+		t.Fatalf("made %d timetable requests, want %d", len(standIn.requests), len(dbPages))
+	}
+	if got := standIn.requests[2].PagingReference; got != "3|OF|MTµ15µ" {
+		t.Errorf("third page reference = %q", got)
+	}
+
+	// Two priced trips on the first page, the unpriced one skipped, the
+	// repeated connection on the second page dropped.
+	var deps []string
+	for _, tr := range trips {
+		deps = append(deps, tr.DepartureTime.Format("15:04"))
+	}
+	if got := strings.Join(deps, " "); got != "06:29 07:04 12:29 18:29" {
+		t.Fatalf("departures = %s, want 06:29 07:04 12:29 18:29", got)
+	}
+
+	direct := trips[0]
+	if direct.Price != 29.99 || direct.Currency != "EUR" {
+		t.Errorf("direct price = %.2f %s, want the Sparpreis 29.99 EUR", direct.Price, direct.Currency)
+	}
+	if direct.Transfers != 0 || direct.VehicleType != "ICE" {
+		t.Errorf("direct = %d transfers, %q", direct.Transfers, direct.VehicleType)
+	}
+	if got := direct.DepartureTime.Format(time.RFC3339); got != "2026-07-10T06:29:00+02:00" {
+		t.Errorf("departure = %s, want Berlin summer time", got)
+	}
+	if got := direct.DepartureTime.Location().String(); got != "Europe/Berlin" {
+		t.Errorf("departure zone = %s", got)
+	}
+	if direct.Duration != "04h 00m" {
+		t.Errorf("duration = %s", direct.Duration)
+	}
+
+	change := trips[1]
+	if change.Transfers != 1 || change.Price != 45.9 {
+		t.Errorf("change trip = %d transfers at %.2f", change.Transfers, change.Price)
+	}
+	if change.VehicleType != "IC, ICE" {
+		t.Errorf("change vehicles = %q, want the walk left out", change.VehicleType)
+	}
+	if change.DestinationStation != "München Hbf" {
+		t.Errorf("destination = %s", change.DestinationStation)
+	}
+
+	for _, tr := range trips {
+		if tr.DepartureTime.Format("15:04") == "07:29" {
+			t.Errorf("trip without angebotsPreis was kept: %+v", tr)
+		}
+	}
+}
+
+func TestDeutscheBahnSearchTripsOtherDay(t *testing.T) {
+	p, standIn := newDBStandIn(t)
+	date := time.Date(2026, 7, 9, 0, 0, 0, 0, time.Local)
+	trips, err := p.SearchTrips(dbBerlin, dbMunich, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trips) != 0 {
+		t.Errorf("got %d trips departing the next day", len(trips))
+	}
+	if len(standIn.requests) != 1 {
+		t.Errorf("kept paging past the requested day: %d requests", len(standIn.requests))
+	}
+}
+
+func TestDeutscheBahnTravellers(t *testing.T) {
+	p := &DeutscheBahnProvider{Options: Options{
+		Passengers: []models.Passenger{{Type: models.PassengerAdult, Age: 30}, {Type: models.PassengerChild, Age: 8}},
+		Cards:      []string{"bahncard25"},
+	}}
+	list := p.travellers()
+	if len(list) != 2 || list[0].Typ != "ERWACHSENER" || list[1].Typ != "KIND" {
+		t.Fatalf("travellers = %+v", list)
+	}
+	if list[0].Ermaessigungen[0].Art != "BAHNCARD25" || list[1].Alter[0] != "8" {
+		t.Errorf("travellers = %+v", list)
+	}
+}
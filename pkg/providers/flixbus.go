@@ -9,15 +9,18 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
-type FlixbusProvider struct{}
+type FlixbusProvider struct {
+	Options Options
+}
 
 func (f *FlixbusProvider) Name() string { return "Flixbus" }
 
-func (f *FlixbusProvider) searchCityAutocomplete(name string) (*models.Location, error) {
+func (f *FlixbusProvider) searchCityAutocomplete(name string) ([]models.Location, error) {
 	utils.DebugLog("Flixbus: Autocomplete search for '%s'", name)
 	u := fmt.Sprintf("https://global.api.flixbus.com/search/autocomplete/cities?q=%s&lang=en&country=en&flixbus_cities_only=true&stations=true", url.QueryEscape(name))
 
@@ -32,42 +35,91 @@ func (f *FlixbusProvider) searchCityAutocomplete(name string) (*models.Location,
 		return nil, err
 	}
 
-	var list []map[string]interface{}
-	if err := json.Unmarshal(body, &list); err == nil {
-		if len(list) > 0 {
-			return &models.Location{
-				ID:   fmt.Sprintf("%v", list[0]["id"]),
-				Name: fmt.Sprintf("%v", list[0]["name"]),
-			}, nil
+	var items []map[string]interface{}
+	if err := json.Unmarshal(body, &items); err != nil {
+		var obj struct {
+			Items []map[string]interface{} `json:"items"`
+		}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			utils.DebugLog("Flixbus: Failed to parse body: %s", string(body))
+			return nil, fmt.Errorf("failed to parse flixbus autocomplete response")
 		}
-		return nil, nil
+		items = obj.Items
 	}
 
-	var obj map[string]interface{}
-	if err := json.Unmarshal(body, &obj); err == nil {
-		if items, ok := obj["items"].([]interface{}); ok && len(items) > 0 {
-			item := items[0].(map[string]interface{})
-			return &models.Location{
-				ID:   fmt.Sprintf("%v", item["id"]),
-				Name: fmt.Sprintf("%v", item["name"]),
-			}, nil
-		}
+	var cands []models.Location
+	for i, item := range items {
+		loc := parseFlixbusCity(item)
+		// Autocomplete is already relevance ordered; keep that order unless
+		// the name itself is a clearly better match.
+		loc.Score = math.Max(0, 1-0.05*float64(i))
+		cands = append(cands, *loc)
 	}
+	return rankCandidates(name, cands, 0), nil
+}
 
-	utils.DebugLog("Flixbus: Failed to parse body: %s", string(body))
-	return nil, fmt.Errorf("failed to parse flixbus autocomplete response")
+func parseFlixbusCity(item map[string]interface{}) *models.Location {
+	loc := &models.Location{
+		ID:   fmt.Sprintf("%v", item["id"]),
+		Name: fmt.Sprintf("%v", item["name"]),
+		Type: models.LocationCity,
+	}
+	if c, ok := item["country"].(string); ok {
+		loc.Country = strings.ToUpper(c)
+	}
+	if l, ok := item["location"].(map[string]interface{}); ok {
+		loc.Latitude, _ = l["lat"].(float64)
+		loc.Longitude, _ = l["lon"].(float64)
+	}
+	return loc
 }
 
 func (f *FlixbusProvider) SearchLocationByName(name string) (*models.Location, error) {
+	return firstCandidate(f.searchCityAutocomplete(name))
+}
+
+func (f *FlixbusProvider) SearchLocationCandidates(name string) ([]models.Location, error) {
 	return f.searchCityAutocomplete(name)
 }
 
+// cms/cities returns at most flixbusCitiesPageSize results per call, so larger
+// boxes are fetched page by page.
+const (
+	flixbusCitiesPageSize = 500
+	flixbusCitiesMaxPages = 40
+)
+
 func (f *FlixbusProvider) getCitiesInBbox(bbox map[string]map[string]float64) ([]models.Location, error) {
 	bboxJson, _ := json.Marshal(bbox)
-	u := fmt.Sprintf("https://global.api.flixbus.com/cms/cities?language=en&limit=5000&geo_bounding_box=%s", url.QueryEscape(string(bboxJson)))
+	seen := make(map[string]bool)
+	var locs []models.Location
+
+	for page := 0; page < flixbusCitiesMaxPages; page++ {
+		u := fmt.Sprintf("https://global.api.flixbus.com/cms/cities?language=en&limit=%d&offset=%d&geo_bounding_box=%s", flixbusCitiesPageSize, page*flixbusCitiesPageSize, url.QueryEscape(string(bboxJson)))
+		utils.DebugLog("Flixbus: Fetching cities in bbox, page %d", page+1)
 
-	utils.DebugLog("Flixbus: Fetching cities in bbox")
+		batch, err := f.fetchCitiesPage(u)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, loc := range batch {
+			if !seen[loc.ID] {
+				seen[loc.ID] = true
+				locs = append(locs, loc)
+				added++
+			}
+		}
+		// A short page is the last one; a page of repeats means the offset
+		// was ignored.
+		if len(batch) < flixbusCitiesPageSize || added == 0 {
+			break
+		}
+	}
+	return locs, nil
+}
 
+func (f *FlixbusProvider) fetchCitiesPage(u string) ([]models.Location, error) {
 	resp, err := http.Get(u)
 	if err != nil {
 		return nil, err
@@ -76,9 +128,13 @@ func (f *FlixbusProvider) getCitiesInBbox(bbox map[string]map[string]float64) ([
 
 	var result struct {
 		Result []struct {
-			ID      string `json:"uuid"`
-			Name    string `json:"name"`
-			Country string `json:"country"`
+			ID       string `json:"uuid"`
+			Name     string `json:"name"`
+			Country  string `json:"country"`
+			Location struct {
+				Lat float64 `json:"lat"`
+				Lon float64 `json:"lon"`
+			} `json:"location"`
 		} `json:"result"`
 	}
 
@@ -88,17 +144,24 @@ func (f *FlixbusProvider) getCitiesInBbox(bbox map[string]map[string]float64) ([
 
 	var locs []models.Location
 	for _, r := range result.Result {
-		locs = append(locs, models.Location{ID: r.ID, Name: r.Name, Country: r.Country})
+		locs = append(locs, models.Location{
+			ID:        r.ID,
+			Name:      r.Name,
+			Country:   strings.ToUpper(r.Country),
+			Type:      models.LocationCity,
+			Latitude:  r.Location.Lat,
+			Longitude: r.Location.Lon,
+		})
 	}
 	return locs, nil
 }
 
 func (f *FlixbusProvider) GetLocationsByCountry(countryCode string) ([]models.Location, error) {
-	names := utils.GetCountryNamesByCode(countryCode)
-	if len(names) == 0 {
-		return nil, fmt.Errorf("unknown country code")
+	geom := utils.CountryGeometryByCode(countryCode)
+	if geom == nil {
+		return nil, fmt.Errorf("no outline for country %q", countryCode)
 	}
-	bbox, err := utils.GetCountryBoundingBox(names[0])
+	bbox, err := utils.GetCountryBoundingBox(countryCode)
 	if err != nil {
 		return nil, err
 	}
@@ -108,33 +171,91 @@ func (f *FlixbusProvider) GetLocationsByCountry(countryCode string) ([]models.Lo
 	}
 	var filtered []models.Location
 	for _, c := range cities {
-		if strings.EqualFold(c.Country, countryCode) {
+		// Trust the country Flixbus reports; fall back to the outline for
+		// cities without one.
+		if c.Country != "" {
+			if strings.EqualFold(c.Country, countryCode) {
+				filtered = append(filtered, c)
+			}
+		} else if geom.Contains(c.Latitude, c.Longitude) {
+			c.Country = geom.Code
 			filtered = append(filtered, c)
 		}
 	}
 	return filtered, nil
 }
 
-func (f *FlixbusProvider) SearchLocationsByDistance(originName string, radiusKm int) ([]models.Location, error) {
-	lat, lon, err := utils.GetCityCoordinates(originName)
-	if err != nil {
-		return nil, err
-	}
-
-	deltaLat := float64(radiusKm) / 111.0
-	deltaLon := float64(radiusKm) / (111.0 * math.Cos(lat*math.Pi/180.0))
+func (f *FlixbusProvider) SearchLocationsByDistance(lat, lon, minKm, maxKm float64) ([]models.Location, error) {
+	deltaLat := maxKm / 111.0
+	deltaLon := maxKm / (111.0 * math.Cos(lat*math.Pi/180.0))
 
 	bbox := map[string]map[string]float64{
 		"top_left":     {"lat": lat + deltaLat, "lon": lon - deltaLon},
 		"bottom_right": {"lat": lat - deltaLat, "lon": lon + deltaLon},
 	}
 
-	return f.getCitiesInBbox(bbox)
+	cities, err := f.getCitiesInBbox(bbox)
+	if err != nil {
+		return nil, err
+	}
+	// The box is only a prefilter; its corners lie outside the circle.
+	var locs []models.Location
+	for _, c := range cities {
+		if withinRing(&c, lat, lon, minKm, maxKm) {
+			locs = append(locs, c)
+		}
+	}
+	return locs, nil
+}
+
+// products maps the party to Flixbus fare products. Flixbus has child fares
+// only; seniors and students pay the adult fare and cards do not apply.
+func (f *FlixbusProvider) products() string {
+	products := make(map[string]int)
+	for _, p := range f.Options.party() {
+		switch {
+		case p.Age < 6:
+			products["children_0_5"]++
+		case p.Age < 15:
+			products["children_6_14"]++
+		default:
+			products["adult"]++
+		}
+	}
+	data, _ := json.Marshal(products)
+	return url.QueryEscape(string(data))
+}
+
+// Currencies Flixbus prices in.
+var flixbusCurrencies = map[string]bool{
+	"EUR": true, "CZK": true, "PLN": true, "HUF": true, "GBP": true, "CHF": true,
+	"DKK": true, "SEK": true, "NOK": true, "RON": true, "BGN": true,
+}
+
+// bookingURL opens the Flixbus shop search for the route, date and party.
+func (f *FlixbusProvider) bookingURL(fromLoc, toLoc models.Location, date time.Time, currency string) string {
+	adults, children := 0, 0
+	for _, p := range f.Options.party() {
+		if p.Age < 15 {
+			children++
+		} else {
+			adults++
+		}
+	}
+	q := url.Values{}
+	q.Set("departureCity", fromLoc.ID)
+	q.Set("arrivalCity", toLoc.ID)
+	q.Set("rideDate", date.Format("02.01.2006"))
+	q.Set("adult", strconv.Itoa(adults))
+	q.Set("children", strconv.Itoa(children))
+	q.Set("currency", currency)
+	return "https://shop.flixbus.com/search?" + q.Encode()
 }
 
 func (f *FlixbusProvider) SearchTrips(fromLoc, toLoc models.Location, date time.Time) ([]models.Trip, error) {
 	dateStr := date.Format("02.01.2006")
-	u := fmt.Sprintf("https://global.api.flixbus.com/search/service/v4/search?from_city_id=%s&to_city_id=%s&departure_date=%s&products=%%7B%%22adult%%22:1%%7D&currency=EUR&locale=en&search_by=cities&include_after_midnight_rides=1", fromLoc.ID, toLoc.ID, dateStr)
+	currency := f.Options.currency(flixbusCurrencies)
+	u := fmt.Sprintf("https://global.api.flixbus.com/search/service/v4/search?from_city_id=%s&to_city_id=%s&departure_date=%s&products=%s&currency=%s&locale=en&search_by=cities&include_after_midnight_rides=1", fromLoc.ID, toLoc.ID, dateStr, f.products(), currency)
 
 	client := http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Get(u)
@@ -167,10 +288,29 @@ func (f *FlixbusProvider) SearchTrips(fromLoc, toLoc models.Location, date time.
 					StationID interface{} `json:"station_id"`
 				} `json:"arrival"`
 				TransferType string `json:"transfer_type"`
+				Status       string `json:"status"`
+				Available    struct {
+					Seats *int `json:"seats"`
+				} `json:"available"`
+				Legs []struct {
+					Departure struct {
+						Date      string      `json:"date"`
+						StationID interface{} `json:"station_id"`
+					} `json:"departure"`
+					Arrival struct {
+						Date      string      `json:"date"`
+						StationID interface{} `json:"station_id"`
+					} `json:"arrival"`
+					MeansOfTransport string `json:"means_of_transport"`
+				} `json:"legs"`
 			} `json:"results"`
 		} `json:"trips"`
 		Stations map[string]struct {
-			Name string `json:"name"`
+			Name        string `json:"name"`
+			Coordinates struct {
+				Latitude  float64 `json:"latitude"`
+				Longitude float64 `json:"longitude"`
+			} `json:"coordinates"`
 		} `json:"stations"`
 	}
 
@@ -179,48 +319,88 @@ func (f *FlixbusProvider) SearchTrips(fromLoc, toLoc models.Location, date time.
 		return nil, err
 	}
 
-	var trips []models.Trip
-	if len(response.Trips) == 0 {
-		return trips, nil
+	// Rides after midnight and night buses may come in later day blocks,
+	// so every block is read and results seen twice are skipped.
+	stationName := func(id interface{}) string {
+		if st, ok := response.Stations[fmt.Sprintf("%v", id)]; ok {
+			return st.Name
+		}
+		return "Unknown"
 	}
+	stationAt := func(id interface{}) (lat, lon float64) {
+		st := response.Stations[fmt.Sprintf("%v", id)]
+		return st.Coordinates.Latitude, st.Coordinates.Longitude
+	}
+	var trips []models.Trip
+	seen := make(map[string]bool)
+	for _, block := range response.Trips {
+		for id, result := range block.Results {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			depTime, err := time.Parse(time.RFC3339, result.Departure.Date)
+			if err != nil {
+				continue
+			}
+			if !departsOn(depTime, date, f.Options.AfterMidnight) {
+				continue
+			}
+			arrTime, _ := time.Parse(time.RFC3339, result.Arrival.Date)
 
-	for _, result := range response.Trips[0].Results {
-		depTime, err := time.Parse(time.RFC3339, result.Departure.Date)
-		if err != nil {
-			continue
-		}
-		if depTime.Format("2006-01-02") != date.Format("2006-01-02") {
-			continue
-		}
-		arrTime, _ := time.Parse(time.RFC3339, result.Arrival.Date)
+			originName := stationName(result.Departure.StationID)
+			destName := stationName(result.Arrival.StationID)
 
-		getStationID := func(v interface{}) string { return fmt.Sprintf("%v", v) }
-		originName := "Unknown"
-		if st, ok := response.Stations[getStationID(result.Departure.StationID)]; ok {
-			originName = st.Name
-		}
-		destName := "Unknown"
-		if st, ok := response.Stations[getStationID(result.Arrival.StationID)]; ok {
-			destName = st.Name
-		}
+			var segments []models.Segment
+			for _, leg := range result.Legs {
+				legDep, err1 := time.Parse(time.RFC3339, leg.Departure.Date)
+				legArr, err2 := time.Parse(time.RFC3339, leg.Arrival.Date)
+				if err1 != nil || err2 != nil {
+					segments = nil
+					break
+				}
+				seg := models.Segment{
+					OriginStation:      stationName(leg.Departure.StationID),
+					DestinationStation: stationName(leg.Arrival.StationID),
+					DepartureTime:      legDep,
+					ArrivalTime:        legArr,
+					VehicleType:        strings.ToUpper(leg.MeansOfTransport),
+				}
+				seg.OriginLatitude, seg.OriginLongitude = stationAt(leg.Departure.StationID)
+				seg.DestinationLatitude, seg.DestinationLongitude = stationAt(leg.Arrival.StationID)
+				segments = append(segments, seg)
+			}
 
-		transfers := 1
-		if result.TransferType == "Direct" {
-			transfers = 0
-		}
+			// Without legs only the transfer type is known, which does not tell
+			// one change from several.
+			transfers := 1
+			switch {
+			case len(segments) > 0:
+				transfers = len(segments) - 1
+			case result.TransferType == "Direct":
+				transfers = 0
+			}
 
-		trips = append(trips, models.Trip{
-			Provider:           "Flixbus",
-			DepartureTime:      depTime,
-			ArrivalTime:        arrTime,
-			Duration:           fmt.Sprintf("%02dh %02dm", result.Duration.Hours, result.Duration.Minutes),
-			Price:              result.Price.Total,
-			Currency:           "EUR",
-			OriginStation:      originName,
-			DestinationStation: destName,
-			Transfers:          transfers,
-			VehicleType:        "BUS",
-		})
+			trip := models.Trip{
+				Provider:           "Flixbus",
+				DepartureTime:      depTime,
+				ArrivalTime:        arrTime,
+				Duration:           fmt.Sprintf("%02dh %02dm", result.Duration.Hours, result.Duration.Minutes),
+				Price:              result.Price.Total,
+				Currency:           currency,
+				OriginStation:      originName,
+				DestinationStation: destName,
+				Transfers:          transfers,
+				VehicleType:        "BUS",
+				SoldOut:            result.Status == "full" || result.Status == "sold_out",
+				Segments:           segments,
+				BookingURL:         f.bookingURL(fromLoc, toLoc, date, currency),
+			}
+			if result.Available.Seats != nil {
+				trip.Seats, trip.SeatsKnown = *result.Available.Seats, true
+			}
+			trips = append(trips, trip)
+		}
 	}
 	return trips, nil
 }
@@ -2,13 +2,83 @@ package providers
 
 import (
 	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/utils"
+	"sort"
 	"time"
 )
 
 type Provider interface {
 	Name() string
 	SearchLocationByName(name string) (*models.Location, error)
+	SearchLocationCandidates(name string) ([]models.Location, error)
 	GetLocationsByCountry(countryCode string) ([]models.Location, error)
-	SearchLocationsByDistance(originName string, radiusKm int) ([]models.Location, error)
+	// SearchLocationsByDistance returns locations between minKm and maxKm of
+	// the point, each with its Distance set.
+	SearchLocationsByDistance(lat, lon, minKm, maxKm float64) ([]models.Location, error)
 	SearchTrips(fromLoc, toLoc models.Location, date time.Time) ([]models.Trip, error)
 }
+
+// Bonus that ranks a city above its own stations for the same query.
+const cityScoreBonus = 0.05
+
+// rankCandidates scores candidates against the query, drops non-matches and
+// sorts best first, keeping the provider's order for ties.
+func rankCandidates(query string, cands []models.Location, minScore float64) []models.Location {
+	var ranked []models.Location
+	for _, c := range cands {
+		score := utils.MatchScore(query, c.Name)
+		if c.Score > score {
+			score = c.Score
+		}
+		if score < minScore {
+			continue
+		}
+		if c.Type == models.LocationCity {
+			score += cityScoreBonus
+		}
+		c.Score = score
+		ranked = append(ranked, c)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	return ranked
+}
+
+// withinRing reports whether loc lies between minKm and maxKm of the point and
+// records the distance on it. Locations without coordinates never match.
+func withinRing(loc *models.Location, lat, lon, minKm, maxKm float64) bool {
+	if loc.Latitude == 0 && loc.Longitude == 0 {
+		return false
+	}
+	d := utils.HaversineDistance(lat, lon, loc.Latitude, loc.Longitude)
+	if d < minKm || d > maxKm {
+		return false
+	}
+	loc.Distance = d
+	return true
+}
+
+// departsOn reports whether a departure, in local time at the origin as the
+// API returned it, falls on the calendar day of date or within after past
+// the following midnight.
+func departsOn(dep, date time.Time, after time.Duration) bool {
+	y, m, d := date.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, dep.Location())
+	return !dep.Before(start) && dep.Before(start.AddDate(0, 0, 1).Add(after))
+}
+
+// searchDays returns the days to ask an API that searches by calendar day
+// for rides departing on date: the day itself and, when rides after midnight
+// are wanted, the next one.
+func searchDays(date time.Time, after time.Duration) []time.Time {
+	if after > 0 {
+		return []time.Time{date, date.AddDate(0, 0, 1)}
+	}
+	return []time.Time{date}
+}
+
+func firstCandidate(cands []models.Location, err error) (*models.Location, error) {
+	if err != nil || len(cands) == 0 {
+		return nil, err
+	}
+	return &cands[0], nil
+}
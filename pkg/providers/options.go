@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"fmt"
+	"github.com/yuriiter/trips/pkg/models"
+	"github.com/yuriiter/trips/pkg/utils"
+	"strings"
+	"time"
+)
+
+// Options are the search settings every provider maps to its own request
+// parameters.
+type Options struct {
+	// Passengers travel together; empty means a single adult.
+	Passengers []models.Passenger
+	// Cards are discount cards held by every passenger: isic, bahncard25,
+	// bahncard50.
+	Cards []string
+	// FareClasses asks for every seat class and the on-board amenities,
+	// which costs providers that support it a request per trip.
+	FareClasses bool
+	// AfterMidnight extends the search day past midnight, so a ride leaving
+	// at 00:30 counts for the evening before.
+	AfterMidnight time.Duration
+	// Currency is requested from providers that price in it; the others
+	// answer in EUR. Empty means EUR.
+	Currency string
+	// Geocoder places locations the provider gives no coordinates for. Nil
+	// means the offline dataset.
+	Geocoder utils.Geocoder
+}
+
+var cardNames = map[string]string{
+	"isic": "isic", "bahncard25": "bahncard25", "bc25": "bahncard25",
+	"bahncard50": "bahncard50", "bc50": "bahncard50",
+}
+
+// ParseCards normalizes a comma separated list of discount cards.
+func ParseCards(input string) ([]string, error) {
+	var cards []string
+	for _, c := range strings.Split(input, ",") {
+		c = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(c), " ", ""))
+		if c == "" {
+			continue
+		}
+		name, ok := cardNames[c]
+		if !ok {
+			return nil, fmt.Errorf("unknown discount card %q (isic, bahncard25, bahncard50)", c)
+		}
+		cards = append(cards, name)
+	}
+	return cards, nil
+}
+
+func (o Options) party() []models.Passenger {
+	if len(o.Passengers) == 0 {
+		return []models.Passenger{{Type: models.PassengerAdult, Age: 30}}
+	}
+	return o.Passengers
+}
+
+// currency returns Currency if the provider supports it, else EUR.
+func (o Options) currency(supported map[string]bool) string {
+	if c := strings.ToUpper(o.Currency); supported[c] {
+		return c
+	}
+	return "EUR"
+}
+
+func (o Options) geocoder() utils.Geocoder {
+	if o.Geocoder == nil {
+		return utils.Offline
+	}
+	return o.Geocoder
+}
+
+func (o Options) hasCard(card string) bool {
+	for _, c := range o.Cards {
+		if c == card {
+			return true
+		}
+	}
+	return false
+}
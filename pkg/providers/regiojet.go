@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"github.com/yuriiter/trips/pkg/models"
 	"github.com/yuriiter/trips/pkg/utils"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,77 +15,174 @@ import (
 )
 
 type RegiojetProvider struct {
-	locationsData []interface{}
-	initOnce      sync.Once
+	Options Options
+
+	index    []regiojetEntry
+	exact    map[string][]int
+	initOnce sync.Once
+	initErr  error
+}
+
+type regiojetStation struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	Fullname  string   `json:"fullname"`
+	Aliases   []string `json:"aliases"`
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+}
+
+type regiojetCity struct {
+	ID       int64             `json:"id"`
+	Name     string            `json:"name"`
+	Aliases  []string          `json:"aliases"`
+	Stations []regiojetStation `json:"stations"`
+}
+
+type regiojetCountry struct {
+	Country string         `json:"country"`
+	Code    string         `json:"code"`
+	Cities  []regiojetCity `json:"cities"`
+}
+
+// regiojetEntry is one searchable city or station with its names and aliases
+// normalized once up front.
+type regiojetEntry struct {
+	loc      models.Location
+	keys     []string
+	stations [][2]float64 // lat/lon of every station, for cities
 }
 
 func (r *RegiojetProvider) Name() string { return "Regiojet" }
 
 func (r *RegiojetProvider) ensureData() error {
-	var err error
 	r.initOnce.Do(func() {
 		utils.DebugLog("Regiojet: Fetching all locations...")
-		resp, reqErr := http.Get("https://brn-ybus-pubapi.sa.cz/restapi/consts/locations")
-		if reqErr != nil {
-			err = reqErr
+		resp, err := http.Get("https://brn-ybus-pubapi.sa.cz/restapi/consts/locations")
+		if err != nil {
+			r.initErr = err
 			return
 		}
 		defer resp.Body.Close()
-		if decodeErr := json.NewDecoder(resp.Body).Decode(&r.locationsData); decodeErr != nil {
-			err = decodeErr
+
+		var countries []regiojetCountry
+		if err := json.NewDecoder(resp.Body).Decode(&countries); err != nil {
+			r.initErr = err
+			return
 		}
+		r.buildIndex(countries)
 	})
-	return err
+	return r.initErr
+}
+
+func normalizedKeys(names ...string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, n := range names {
+		k := utils.NormalizeName(n)
+		if k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
 }
 
-func (r *RegiojetProvider) parseCity(data map[string]interface{}) *models.Location {
-	var id string
-	switch v := data["id"].(type) {
-	case float64:
-		id = fmt.Sprintf("%.0f", v)
-	default:
-		id = fmt.Sprintf("%v", v)
+func (r *RegiojetProvider) buildIndex(countries []regiojetCountry) {
+	r.exact = make(map[string][]int)
+	add := func(e regiojetEntry) {
+		for _, k := range e.keys {
+			r.exact[k] = append(r.exact[k], len(r.index))
+		}
+		r.index = append(r.index, e)
 	}
 
-	name := data["name"].(string)
+	for _, country := range countries {
+		for _, city := range country.Cities {
+			cityLoc := models.Location{
+				ID:      strconv.FormatInt(city.ID, 10),
+				Name:    city.Name,
+				Country: country.Code,
+				Type:    models.LocationCity,
+			}
+			if len(city.Stations) > 0 {
+				cityLoc.Latitude = city.Stations[0].Latitude
+				cityLoc.Longitude = city.Stations[0].Longitude
+			}
+			var points [][2]float64
+			for _, st := range city.Stations {
+				points = append(points, [2]float64{st.Latitude, st.Longitude})
+			}
+			add(regiojetEntry{
+				loc:      cityLoc,
+				keys:     normalizedKeys(append([]string{city.Name}, city.Aliases...)...),
+				stations: points,
+			})
 
-	var lat, lon float64
-	if stations, ok := data["stations"].([]interface{}); ok && len(stations) > 0 {
-		s := stations[0].(map[string]interface{})
-		if l, ok := s["latitude"].(float64); ok {
-			lat = l
+			for _, st := range city.Stations {
+				name := st.Fullname
+				if name == "" {
+					name = st.Name
+				}
+				add(regiojetEntry{
+					loc: models.Location{
+						ID:        strconv.FormatInt(st.ID, 10),
+						Name:      name,
+						Country:   country.Code,
+						Latitude:  st.Latitude,
+						Longitude: st.Longitude,
+						Type:      models.LocationStation,
+					},
+					keys: normalizedKeys(append([]string{name, st.Name}, st.Aliases...)...),
+				})
+			}
 		}
-		if l, ok := s["longitude"].(float64); ok {
-			lon = l
+	}
+	utils.DebugLog("Regiojet: Indexed %d locations", len(r.index))
+}
+
+func (r *RegiojetProvider) cities() []models.Location {
+	var locs []models.Location
+	for _, e := range r.index {
+		if e.loc.Type == models.LocationCity {
+			locs = append(locs, e.loc)
 		}
 	}
-	return &models.Location{ID: id, Name: name, Latitude: lat, Longitude: lon}
+	return locs
 }
+
 func (r *RegiojetProvider) SearchLocationByName(name string) (*models.Location, error) {
 	if err := r.ensureData(); err != nil {
 		return nil, err
 	}
+	for _, i := range r.exact[utils.NormalizeName(name)] {
+		if r.index[i].loc.Type == models.LocationCity {
+			loc := r.index[i].loc
+			return &loc, nil
+		}
+	}
+	return firstCandidate(r.SearchLocationCandidates(name))
+}
 
-	searchLower := strings.ToLower(name)
-	for _, country := range r.locationsData {
-		cMap := country.(map[string]interface{})
-		cities := cMap["cities"].([]interface{})
-		for _, city := range cities {
-			c := city.(map[string]interface{})
-			cName := c["name"].(string)
-			if strings.EqualFold(cName, searchLower) {
-				return r.parseCity(c), nil
-			}
-			if aliases, ok := c["aliases"].([]interface{}); ok {
-				for _, a := range aliases {
-					if strings.EqualFold(a.(string), searchLower) {
-						return r.parseCity(c), nil
-					}
-				}
-			}
+func (r *RegiojetProvider) SearchLocationCandidates(name string) ([]models.Location, error) {
+	if err := r.ensureData(); err != nil {
+		return nil, err
+	}
+
+	query := utils.NormalizeName(name)
+	var cands []models.Location
+	for _, e := range r.index {
+		score := 0.0
+		for _, k := range e.keys {
+			score = math.Max(score, utils.MatchNormalized(query, k))
+		}
+		if score > 0 {
+			loc := e.loc
+			loc.Score = score
+			cands = append(cands, loc)
 		}
 	}
-	return nil, nil
+	return rankCandidates(name, cands, utils.FuzzyMinScore), nil
 }
 
 func (r *RegiojetProvider) GetLocationsByCountry(countryCode string) ([]models.Location, error) {
@@ -91,55 +190,179 @@ func (r *RegiojetProvider) GetLocationsByCountry(countryCode string) ([]models.L
 		return nil, err
 	}
 	var locs []models.Location
-	for _, country := range r.locationsData {
-		cMap := country.(map[string]interface{})
-		code := cMap["code"].(string)
-		if strings.EqualFold(code, countryCode) {
-			cities := cMap["cities"].([]interface{})
-			for _, city := range cities {
-				locs = append(locs, *r.parseCity(city.(map[string]interface{})))
-			}
+	for _, city := range r.cities() {
+		if strings.EqualFold(city.Country, countryCode) {
+			locs = append(locs, city)
 		}
 	}
 	return locs, nil
 }
 
-func (r *RegiojetProvider) SearchLocationsByDistance(originName string, radiusKm int) ([]models.Location, error) {
+// SearchLocationsByDistance measures every city by its nearest station, so a
+// city whose main station lies just outside the ring is still found through
+// its other stations.
+func (r *RegiojetProvider) SearchLocationsByDistance(lat, lon, minKm, maxKm float64) ([]models.Location, error) {
 	if err := r.ensureData(); err != nil {
 		return nil, err
 	}
-	originLat, originLon, err := utils.GetCityCoordinates(originName)
-	if err != nil {
-		return nil, err
-	}
 
 	var locs []models.Location
 	seen := make(map[string]bool)
+	for _, e := range r.index {
+		if e.loc.Type != models.LocationCity || seen[e.loc.ID] {
+			continue
+		}
+		seen[e.loc.ID] = true
 
-	for _, country := range r.locationsData {
-		cMap := country.(map[string]interface{})
-		cities := cMap["cities"].([]interface{})
-		for _, cityData := range cities {
-			city := r.parseCity(cityData.(map[string]interface{}))
-			if seen[city.Name] {
+		nearest := math.Inf(1)
+		for _, st := range e.stations {
+			if st[0] != 0 || st[1] != 0 {
+				nearest = math.Min(nearest, utils.HaversineDistance(lat, lon, st[0], st[1]))
+			}
+		}
+		// Cities whose stations carry no coordinates are placed by name.
+		if math.IsInf(nearest, 1) {
+			cLat, cLon, err := r.Options.geocoder().Geocode(e.loc.Name)
+			if err != nil {
 				continue
 			}
-			if city.Latitude != 0 && city.Longitude != 0 {
-				dist := utils.HaversineDistance(originLat, originLon, city.Latitude, city.Longitude)
-				if dist <= float64(radiusKm) {
-					locs = append(locs, *city)
+			nearest = utils.HaversineDistance(lat, lon, cLat, cLon)
+		}
+		if nearest >= minKm && nearest <= maxKm {
+			loc := e.loc
+			loc.Distance = nearest
+			locs = append(locs, loc)
+		}
+	}
+	return locs, nil
+}
+
+func regiojetLocationType(loc models.Location) string {
+	if loc.Type == models.LocationStation {
+		return "STATION"
+	}
+	return "CITY"
+}
+
+// tariffs lists one Regiojet tariff per passenger. Students get the ISIC
+// tariff when they hold the card, else the youth one while it applies.
+func (r *RegiojetProvider) tariffs() string {
+	var params []string
+	for _, p := range r.Options.party() {
+		tariff := "REGULAR"
+		switch {
+		case p.Age < 6:
+			tariff = "CHILD_6"
+		case p.Age < 15:
+			tariff = "CHILD_15"
+		case p.Type == models.PassengerStudent && r.Options.hasCard("isic"):
+			tariff = "ISIC"
+		case p.Age <= 26 && p.Type != models.PassengerAdult:
+			tariff = "YOUTH_26"
+		case p.Age >= 70:
+			tariff = "SENIOR_70"
+		case p.Age >= 65:
+			tariff = "SENIOR_65"
+		}
+		params = append(params, "tariffs="+tariff)
+	}
+	return strings.Join(params, "&")
+}
+
+// Readable names of Regiojet seat classes; unknown keys are shown as sent.
+var regiojetClassNames = map[string]string{
+	"TRAIN_LOW_COST": "Low cost", "TRAIN_STANDARD": "Standard", "TRAIN_RELAX": "Relax",
+	"TRAIN_BUSINESS": "Business", "TRAIN_PREMIUM": "Premium", "C0": "Standard",
+	"BUS_STANDARD": "Standard", "BUS_STAR": "Fun & Relax",
+}
+
+// Amenities are recognized by keywords in the service codes of a route.
+var regiojetAmenities = []struct {
+	name     string
+	keywords []string
+}{
+	{"wifi", []string{"wifi", "wi-fi", "internet"}},
+	{"power", []string{"socket", "power", "plug", "usb"}},
+	{"catering", []string{"refreshment", "catering", "bistro", "snack", "drink", "restaurant"}},
+}
+
+// Currencies Regiojet prices in.
+var regiojetCurrencies = map[string]bool{
+	"EUR": true, "CZK": true, "HUF": true, "PLN": true, "UAH": true, "RON": true,
+}
+
+// regiojetDetailWorkers bounds the route detail requests of one search, which
+// itself runs alongside the other searches.
+const regiojetDetailWorkers = 4
+
+// routeDetail fetches the seat classes and services of one route.
+func (r *RegiojetProvider) routeDetail(client *http.Client, routeID, fromStation, toStation int64) ([]models.Fare, []string, error) {
+	u := fmt.Sprintf("https://brn-ybus-pubapi.sa.cz/restapi/routes/%d/simple?fromStationId=%d&toStationId=%d&%s&currency=%s", routeID, fromStation, toStation, r.tariffs(), r.Options.currency(regiojetCurrencies))
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, nil, fmt.Errorf("api error %d", resp.StatusCode)
+	}
+
+	var detail struct {
+		PriceClasses []struct {
+			SeatClassKey   string  `json:"seatClassKey"`
+			Price          float64 `json:"price"`
+			FreeSeatsCount *int    `json:"freeSeatsCount"`
+		} `json:"priceClasses"`
+		Services []string `json:"services"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+		return nil, nil, err
+	}
+
+	var fares []models.Fare
+	for _, pc := range detail.PriceClasses {
+		name, ok := regiojetClassNames[pc.SeatClassKey]
+		if !ok {
+			name = pc.SeatClassKey
+		}
+		fare := models.Fare{Class: name, Price: pc.Price}
+		if pc.FreeSeatsCount != nil {
+			fare.Seats, fare.SeatsKnown = *pc.FreeSeatsCount, true
+		}
+		fares = append(fares, fare)
+	}
+
+	var amenities []string
+	for _, a := range regiojetAmenities {
+	services:
+		for _, s := range detail.Services {
+			for _, k := range a.keywords {
+				if strings.Contains(strings.ToLower(s), k) {
+					amenities = append(amenities, a.name)
+					break services
 				}
 			}
-			seen[city.Name] = true
 		}
 	}
-	return locs, nil
+	return fares, amenities, nil
 }
 
-func (r *RegiojetProvider) SearchTrips(fromLoc, toLoc models.Location, date time.Time) ([]models.Trip, error) {
-	dateStr := date.Format("2006-01-02")
-	u := fmt.Sprintf("https://brn-ybus-pubapi.sa.cz/restapi/routes/search/simple?tariffs=REGULAR&toLocationType=CITY&toLocationId=%s&fromLocationType=CITY&fromLocationId=%s&departureDate=%s&currency=EUR", toLoc.ID, fromLoc.ID, dateStr)
-	client := http.Client{Timeout: 10 * time.Second}
+type regiojetRoute struct {
+	ID                 int64    `json:"id"`
+	DepartureStationID int64    `json:"departureStationId"`
+	ArrivalStationID   int64    `json:"arrivalStationId"`
+	DepartureTime      string   `json:"departureTime"`
+	ArrivalTime        string   `json:"arrivalTime"`
+	TravelTime         string   `json:"travelTime"`
+	PriceFrom          float64  `json:"priceFrom"`
+	TransfersCount     int      `json:"transfersCount"`
+	VehicleTypes       []string `json:"vehicleTypes"`
+	FreeSeatsCount     *int     `json:"freeSeatsCount"`
+}
+
+// searchRoutes lists the routes departing on one calendar day.
+func (r *RegiojetProvider) searchRoutes(client *http.Client, fromLoc, toLoc models.Location, day time.Time, currency string) ([]regiojetRoute, error) {
+	u := fmt.Sprintf("https://brn-ybus-pubapi.sa.cz/restapi/routes/search/simple?%s&toLocationType=%s&toLocationId=%s&fromLocationType=%s&fromLocationId=%s&departureDate=%s&currency=%s", r.tariffs(), regiojetLocationType(toLoc), toLoc.ID, regiojetLocationType(fromLoc), fromLoc.ID, day.Format("2006-01-02"), currency)
 	resp, err := client.Get(u)
 	if err != nil {
 		return nil, err
@@ -151,29 +374,45 @@ func (r *RegiojetProvider) SearchTrips(fromLoc, toLoc models.Location, date time
 	}
 
 	var response struct {
-		Routes []struct {
-			DepartureTime  string   `json:"departureTime"`
-			ArrivalTime    string   `json:"arrivalTime"`
-			TravelTime     string   `json:"travelTime"`
-			PriceFrom      float64  `json:"priceFrom"`
-			TransfersCount int      `json:"transfersCount"`
-			VehicleTypes   []string `json:"vehicleTypes"`
-		} `json:"routes"`
+		Routes []regiojetRoute `json:"routes"`
 	}
-
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, err
 	}
+	return response.Routes, nil
+}
+
+func (r *RegiojetProvider) SearchTrips(fromLoc, toLoc models.Location, date time.Time) ([]models.Trip, error) {
+	currency := r.Options.currency(regiojetCurrencies)
+	client := http.Client{Timeout: 10 * time.Second}
+
+	// Rides after midnight are only listed under the next day.
+	var found []regiojetRoute
+	seen := make(map[int64]bool)
+	for _, day := range searchDays(date, r.Options.AfterMidnight) {
+		list, err := r.searchRoutes(&client, fromLoc, toLoc, day, currency)
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range list {
+			if !seen[route.ID] {
+				seen[route.ID] = true
+				found = append(found, route)
+			}
+		}
+	}
 
 	var trips []models.Trip
-	for _, route := range response.Routes {
+	// routes keeps the route and station IDs of every trip for the details.
+	var routes [][3]int64
+	for _, route := range found {
 		depTime, err := time.Parse("2006-01-02T15:04:05.000-07:00", route.DepartureTime)
 		if err != nil {
 			utils.DebugLog("Error parsing time: %v", err)
 			continue
 		}
 
-		if depTime.Format("2006-01-02") != dateStr {
+		if !departsOn(depTime, date, r.Options.AfterMidnight) {
 			continue
 		}
 		arrTime, _ := time.Parse("2006-01-02T15:04:05.000-07:00", route.ArrivalTime)
@@ -190,18 +429,75 @@ func (r *RegiojetProvider) SearchTrips(fromLoc, toLoc models.Location, date time
 			finalDur = fmt.Sprintf("%02dh %02dm", h, m)
 		}
 
-		trips = append(trips, models.Trip{
+		trip := models.Trip{
 			Provider:           "Regiojet",
 			DepartureTime:      depTime,
 			ArrivalTime:        arrTime,
 			Duration:           finalDur,
 			Price:              route.PriceFrom,
-			Currency:           "EUR",
+			Currency:           currency,
 			OriginStation:      fromLoc.Name,
 			DestinationStation: toLoc.Name,
 			Transfers:          route.TransfersCount,
 			VehicleType:        strings.Join(route.VehicleTypes, ", "),
-		})
+		}
+		// Without a count the seats are unknown, not sold out.
+		if route.FreeSeatsCount != nil {
+			trip.Seats, trip.SeatsKnown = *route.FreeSeatsCount, true
+			trip.SoldOut = trip.Seats == 0
+		}
+		q := url.Values{}
+		q.Set("fromStationId", strconv.FormatInt(route.DepartureStationID, 10))
+		q.Set("toStationId", strconv.FormatInt(route.ArrivalStationID, 10))
+		q.Set("departureDate", depTime.Format("2006-01-02"))
+		q.Set("currency", currency)
+		trip.BookingURL = fmt.Sprintf("https://shop.regiojet.com/route/%d?%s&%s", route.ID, q.Encode(), r.tariffs())
+		trips = append(trips, trip)
+		routes = append(routes, [3]int64{route.ID, route.DepartureStationID, route.ArrivalStationID})
+	}
+	if !r.Options.FareClasses {
+		return trips, nil
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, regiojetDetailWorkers)
+	for i := range trips {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fares, amenities, err := r.routeDetail(&client, routes[i][0], routes[i][1], routes[i][2])
+			if err != nil {
+				utils.DebugLog("Regiojet: route %d detail: %v", routes[i][0], err)
+				return
+			}
+			trips[i].Fares, trips[i].Amenities = fares, amenities
+		}(i)
+	}
+	wg.Wait()
+	return classTrips(trips), nil
+}
+
+// classTrips turns every seat class into a trip of its own with the class
+// price and free seats, so sorting and the Pareto front compare the classes.
+// Trips whose classes could not be fetched stay as they are.
+func classTrips(trips []models.Trip) []models.Trip {
+	var out []models.Trip
+	for _, t := range trips {
+		if len(t.Fares) == 0 {
+			out = append(out, t)
+			continue
+		}
+		for _, f := range t.Fares {
+			c := t
+			c.Price, c.Seats, c.SeatsKnown = f.Price, f.Seats, f.SeatsKnown
+			if f.SeatsKnown {
+				c.SoldOut = f.Seats == 0
+			}
+			c.Fares = []models.Fare{f}
+			out = append(out, c)
+		}
 	}
-	return trips, nil
+	return out
 }
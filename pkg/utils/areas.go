@@ -0,0 +1,101 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//go:embed data/regions.json
+var regionsJSON []byte
+
+// Area is a destination larger than a city: a country, a group of countries
+// or a region within one country. Searches expand it to every location the
+// providers know in its countries, narrowed to the region outline if any.
+type Area struct {
+	Name      string
+	Countries []string
+	Polygons  [][][2]float64
+}
+
+// countryGroups are the informal groupings people search by.
+var countryGroups = map[string][]string{
+	"benelux":       {"BE", "NL", "LU"},
+	"dach":          {"DE", "AT", "CH"},
+	"balkans":       {"AL", "BA", "BG", "GR", "HR", "ME", "MK", "RS", "SI"},
+	"baltics":       {"EE", "LV", "LT"},
+	"baltic states": {"EE", "LV", "LT"},
+	"scandinavia":   {"DK", "NO", "SE"},
+	"nordics":       {"DK", "FI", "IS", "NO", "SE"},
+	"visegrad":      {"CZ", "HU", "PL", "SK"},
+	"v4":            {"CZ", "HU", "PL", "SK"},
+	"iberia":        {"ES", "PT"},
+	"british isles": {"GB", "IE"},
+}
+
+type region struct {
+	Name     string         `json:"name"`
+	Country  string         `json:"country"`
+	Aliases  []string       `json:"aliases"`
+	Polygons [][][2]float64 `json:"polygons"`
+}
+
+var (
+	regionsOnce   sync.Once
+	regionsByName map[string]*region
+)
+
+func loadRegions() {
+	regionsOnce.Do(func() {
+		var list []*region
+		if err := json.Unmarshal(regionsJSON, &list); err != nil {
+			panic(fmt.Sprintf("utils: bad embedded regions.json: %v", err))
+		}
+		regionsByName = make(map[string]*region)
+		for _, r := range list {
+			for _, n := range append([]string{r.Name}, r.Aliases...) {
+				regionsByName[NormalizeName(n)] = r
+			}
+		}
+	})
+}
+
+// LookupArea recognizes countries (see LookupCountry), country groups such
+// as "benelux" and regions such as "Bavaria". It returns nil for city names.
+func LookupArea(name string) *Area {
+	if c := LookupCountry(name); c != nil {
+		return &Area{Name: c.Name, Countries: []string{c.Alpha2}}
+	}
+	key := NormalizeName(name)
+	if codes, ok := countryGroups[key]; ok {
+		return &Area{Name: strings.TrimSpace(name), Countries: codes}
+	}
+	loadRegions()
+	if r, ok := regionsByName[key]; ok {
+		return &Area{Name: r.Name, Countries: []string{r.Country}, Polygons: r.Polygons}
+	}
+	return nil
+}
+
+// IsRegion reports whether the area is only part of its country.
+func (a *Area) IsRegion() bool { return len(a.Polygons) > 0 }
+
+// Contains reports whether a point belongs to the area. Whole countries are
+// trusted to the providers' own country codes, so only regions check the
+// outline.
+func (a *Area) Contains(lat, lon float64) bool {
+	if !a.IsRegion() {
+		return true
+	}
+	if lat == 0 && lon == 0 {
+		return false
+	}
+	for _, poly := range a.Polygons {
+		if pointInPolygon(lat, lon, poly) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed data/countries.json
+var countriesJSON []byte
+
+//go:embed data/iso3166.tsv
+var iso3166TSV []byte
+
+// Country is one ISO 3166-1 entry. Names holds local names and common
+// aliases in the languages of our users.
+type Country struct {
+	Alpha2 string
+	Alpha3 string
+	Name   string
+	Names  []string
+}
+
+var (
+	countryTableOnce sync.Once
+	countriesByCode  map[string]*Country
+	countriesByName  map[string]*Country
+)
+
+func loadCountryTable() {
+	countryTableOnce.Do(func() {
+		countriesByCode = make(map[string]*Country)
+		countriesByName = make(map[string]*Country)
+		sc := bufio.NewScanner(bytes.NewReader(iso3166TSV))
+		for sc.Scan() {
+			line := sc.Text()
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			cols := strings.Split(line, "\t")
+			if len(cols) < 3 {
+				continue
+			}
+			c := &Country{Alpha2: cols[0], Alpha3: cols[1], Name: cols[2]}
+			if len(cols) > 3 && cols[3] != "" {
+				c.Names = strings.Split(cols[3], ",")
+			}
+			countriesByCode[c.Alpha2] = c
+			countriesByCode[c.Alpha3] = c
+			for _, n := range append([]string{c.Name}, c.Names...) {
+				if k := NormalizeName(n); k != "" && countriesByName[k] == nil {
+					countriesByName[k] = c
+				}
+			}
+		}
+	})
+}
+
+// CountryByCode returns the country with the given alpha-2 or alpha-3 code.
+func CountryByCode(code string) *Country {
+	loadCountryTable()
+	return countriesByCode[strings.ToUpper(strings.TrimSpace(code))]
+}
+
+// LookupCountry recognizes a country by its English, local or alternative
+// name, ignoring case and diacritics, or by a code written in capitals ("UA",
+// "CHE"), so towns such as "Bra" or "Aus" are not taken for countries. It
+// returns nil for anything else, which callers treat as a city name.
+func LookupCountry(name string) *Country {
+	name = strings.TrimSpace(name)
+	if n := len(name); (n == 2 || n == 3) && name == strings.ToUpper(name) {
+		if c := CountryByCode(name); c != nil {
+			return c
+		}
+	}
+	loadCountryTable()
+	return countriesByName[NormalizeName(name)]
+}
+
+// CountryGeometry is the outline of one country: a tight bounding box
+// (min lon, min lat, max lon, max lat) and simplified polygons of lon/lat
+// pairs, one per mainland or major island.
+type CountryGeometry struct {
+	Code     string         `json:"code"`
+	BBox     [4]float64     `json:"bbox"`
+	Polygons [][][2]float64 `json:"polygons"`
+}
+
+var (
+	countryGeomOnce sync.Once
+	countryGeoms    map[string]*CountryGeometry
+)
+
+func loadCountryGeometry() {
+	countryGeomOnce.Do(func() {
+		var list []*CountryGeometry
+		if err := json.Unmarshal(countriesJSON, &list); err != nil {
+			panic(fmt.Sprintf("utils: bad embedded countries.json: %v", err))
+		}
+		countryGeoms = make(map[string]*CountryGeometry, len(list))
+		for _, g := range list {
+			countryGeoms[g.Code] = g
+		}
+	})
+}
+
+// CountryGeometryByCode returns the outline of an ISO alpha-2 country, or nil
+// if the country is not covered by the bundled dataset.
+func CountryGeometryByCode(code string) *CountryGeometry {
+	loadCountryGeometry()
+	return countryGeoms[strings.ToUpper(code)]
+}
+
+// InBBox reports whether the point lies within the country's bounding box.
+func (g *CountryGeometry) InBBox(lat, lon float64) bool {
+	return lon >= g.BBox[0] && lat >= g.BBox[1] && lon <= g.BBox[2] && lat <= g.BBox[3]
+}
+
+// Contains reports whether the point lies inside one of the country's
+// polygons. The outlines are simplified, so points within a few kilometres of
+// a border may land on the wrong side.
+func (g *CountryGeometry) Contains(lat, lon float64) bool {
+	if !g.InBBox(lat, lon) {
+		return false
+	}
+	for _, poly := range g.Polygons {
+		if pointInPolygon(lat, lon, poly) {
+			return true
+		}
+	}
+	return false
+}
+
+// pointInPolygon is the even-odd ray casting test.
+func pointInPolygon(lat, lon float64, poly [][2]float64) bool {
+	in := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		xi, yi := poly[i][0], poly[i][1]
+		xj, yj := poly[j][0], poly[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
+
+// CountryAt returns the code of the country containing the point, or "" when
+// it falls outside every bundled outline.
+func CountryAt(lat, lon float64) string {
+	loadCountryGeometry()
+	codes := make([]string, 0, len(countryGeoms))
+	for code := range countryGeoms {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if countryGeoms[code].Contains(lat, lon) {
+			return code
+		}
+	}
+	return ""
+}
+
+// GetCountryBoundingBox returns the tight bounding box of a country in the
+// top_left/bottom_right form the Flixbus geo queries expect.
+func GetCountryBoundingBox(countryCode string) (map[string]map[string]float64, error) {
+	g := CountryGeometryByCode(countryCode)
+	if g == nil {
+		return nil, fmt.Errorf("no geometry for country %q", countryCode)
+	}
+	return map[string]map[string]float64{
+		"top_left":     {"lat": g.BBox[3], "lon": g.BBox[0]},
+		"bottom_right": {"lat": g.BBox[1], "lon": g.BBox[2]},
+	}, nil
+}
@@ -1,12 +1,9 @@
 package utils
 
 import (
-	"encoding/json"
-	"fmt"
 	"math"
-	"net/http"
-	"net/url"
-	"time"
+	"strconv"
+	"strings"
 )
 
 func HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
@@ -25,42 +22,17 @@ func HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	return earthRadiusKm * c
 }
 
-func GetCityCoordinates(city string) (float64, float64, error) {
-	DebugLog("Fetching coords for %s", city)
-	u := fmt.Sprintf("https://nominatim.openstreetmap.org/search?q=%s&format=json&limit=1", url.QueryEscape(city))
-
-	req, _ := http.NewRequest("GET", u, nil)
-	req.Header.Set("User-Agent", "TripSearchCLI/1.0")
-
-	client := http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, 0, err
-	}
-	defer resp.Body.Close()
-
-	var result []struct {
-		Lat string `json:"lat"`
-		Lon string `json:"lon"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return 0, 0, err
+// ParseCoordinates reads a "lat,lon" pair in decimal degrees such as
+// "49.19,16.61".
+func ParseCoordinates(s string) (lat, lon float64, ok bool) {
+	latStr, lonStr, found := strings.Cut(s, ",")
+	if !found {
+		return 0, 0, false
 	}
-	if len(result) == 0 {
-		return 0, 0, fmt.Errorf("coordinates not found for %s", city)
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err1 != nil || err2 != nil || !(lat >= -90 && lat <= 90) || !(lon >= -180 && lon <= 180) {
+		return 0, 0, false
 	}
-
-	var lat, lon float64
-	fmt.Sscanf(result[0].Lat, "%f", &lat)
-	fmt.Sscanf(result[0].Lon, "%f", &lon)
-
-	return lat, lon, nil
-}
-
-func GetCountryBoundingBox(countryName string) (map[string]map[string]float64, error) {
-	DebugLog("Using generic Europe BBox for country %s", countryName)
-	return map[string]map[string]float64{
-		"top_left":     {"lat": 71.0, "lon": -10.0},
-		"bottom_right": {"lat": 35.0, "lon": 40.0},
-	}, nil
+	return lat, lon, true
 }
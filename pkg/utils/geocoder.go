@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Geocoder interface {
+	Geocode(name string) (lat, lon float64, err error)
+}
+
+//go:embed data/cities.tsv
+var citiesTSV []byte
+
+// GeoPlace is one row of the bundled populated places dataset.
+type GeoPlace struct {
+	Name       string
+	Country    string
+	Latitude   float64
+	Longitude  float64
+	Population int
+	Alternates []string
+}
+
+// OfflineGeocoder resolves names against the embedded GeoNames-style dataset
+// of European populated places. When several places share a name the most
+// populous one wins.
+type OfflineGeocoder struct {
+	once   sync.Once
+	places []GeoPlace
+	byName map[string]int
+}
+
+func (g *OfflineGeocoder) load() {
+	g.once.Do(func() {
+		g.byName = make(map[string]int)
+		sc := bufio.NewScanner(bytes.NewReader(citiesTSV))
+		for sc.Scan() {
+			line := sc.Text()
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			cols := strings.Split(line, "\t")
+			if len(cols) < 7 {
+				continue
+			}
+			lat, _ := strconv.ParseFloat(cols[3], 64)
+			lon, _ := strconv.ParseFloat(cols[4], 64)
+			pop, _ := strconv.Atoi(cols[6])
+			p := GeoPlace{Name: cols[0], Country: cols[5], Latitude: lat, Longitude: lon, Population: pop}
+			if cols[2] != "" {
+				p.Alternates = strings.Split(cols[2], ",")
+			}
+			idx := len(g.places)
+			g.places = append(g.places, p)
+
+			for _, n := range append([]string{cols[0], cols[1]}, p.Alternates...) {
+				k := NormalizeName(n)
+				if k == "" {
+					continue
+				}
+				if prev, ok := g.byName[k]; !ok || g.places[prev].Population < pop {
+					g.byName[k] = idx
+				}
+			}
+		}
+		DebugLog("Geocoder: loaded %d offline places", len(g.places))
+	})
+}
+
+// Lookup returns the dataset entry for a name, or nil. Station names such as
+// "München Hbf" fall back to their longest leading words naming a place.
+func (g *OfflineGeocoder) Lookup(name string) *GeoPlace {
+	g.load()
+	words := strings.Fields(NormalizeName(name))
+	for n := len(words); n > 0; n-- {
+		if idx, ok := g.byName[strings.Join(words[:n], " ")]; ok {
+			return &g.places[idx]
+		}
+	}
+	return nil
+}
+
+// Places returns every place of the dataset.
+func (g *OfflineGeocoder) Places() []GeoPlace {
+	g.load()
+	return g.places
+}
+
+func (g *OfflineGeocoder) Geocode(name string) (float64, float64, error) {
+	if p := g.Lookup(name); p != nil {
+		return p.Latitude, p.Longitude, nil
+	}
+	return 0, 0, fmt.Errorf("coordinates not found for %s", name)
+}
+
+// NominatimGeocoder queries nominatim.openstreetmap.org. It is slow and rate
+// limited, so it only serves as a fallback.
+type NominatimGeocoder struct{}
+
+func (NominatimGeocoder) Geocode(city string) (float64, float64, error) {
+	DebugLog("Fetching coords for %s from Nominatim", city)
+	u := fmt.Sprintf("https://nominatim.openstreetmap.org/search?q=%s&format=json&limit=1", url.QueryEscape(city))
+
+	req, _ := http.NewRequest("GET", u, nil)
+	req.Header.Set("User-Agent", "TripSearchCLI/1.0")
+
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	var result []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, 0, err
+	}
+	if len(result) == 0 {
+		return 0, 0, fmt.Errorf("coordinates not found for %s", city)
+	}
+
+	var lat, lon float64
+	fmt.Sscanf(result[0].Lat, "%f", &lat)
+	fmt.Sscanf(result[0].Lon, "%f", &lon)
+
+	return lat, lon, nil
+}
+
+// FallbackGeocoder tries each geocoder in order and returns the first hit.
+type FallbackGeocoder []Geocoder
+
+func (f FallbackGeocoder) Geocode(name string) (float64, float64, error) {
+	err := fmt.Errorf("coordinates not found for %s", name)
+	for _, g := range f {
+		lat, lon, gErr := g.Geocode(name)
+		if gErr == nil {
+			return lat, lon, nil
+		}
+		err = gErr
+	}
+	return 0, 0, err
+}
+
+// Offline is the geocoder backed by the embedded dataset.
+var Offline = &OfflineGeocoder{}
@@ -1,22 +1,77 @@
 package utils
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/yuriiter/trips/pkg/models"
 )
 
+// maxPassengers is the largest party the providers book in one search.
+const maxPassengers = 9
+
+// Ages assumed for passenger categories given without one.
+var passengerAges = map[string]int{
+	models.PassengerAdult:   30,
+	models.PassengerSenior:  65,
+	models.PassengerStudent: 22,
+}
+
+var passengerTypes = map[string]string{
+	"a": models.PassengerAdult, "c": models.PassengerChild,
+	"s": models.PassengerSenior, "st": models.PassengerStudent,
+}
+
+var weekdays = map[string]time.Weekday{
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+	"sun": time.Sunday, "sunday": time.Sunday,
+}
+
+// parseWeekday understands "fri" (the coming Friday, today if it is one) and
+// "next fri" (the first Friday after today).
+func parseWeekday(s string, now time.Time) (time.Time, bool) {
+	s = strings.ToLower(s)
+	next := false
+	if rest, ok := strings.CutPrefix(s, "next "); ok {
+		s, next = strings.TrimSpace(rest), true
+	}
+	wd, ok := weekdays[s]
+	if !ok {
+		return time.Time{}, false
+	}
+	days := (int(wd) - int(now.Weekday()) + 7) % 7
+	if days == 0 && next {
+		days = 7
+	}
+	return now.AddDate(0, 0, days), true
+}
+
+// ParseDates returns the listed days as midnight in the local time zone.
 func ParseDates(input string) ([]time.Time, error) {
 	var dates []time.Time
 	parts := strings.Split(input, ",")
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
 
 	for _, p := range parts {
 		p = strings.TrimSpace(p)
+		if d, ok := parseWeekday(p, today); ok {
+			dates = append(dates, d)
+			continue
+		}
 		if p == "today" {
-			dates = append(dates, time.Now())
+			dates = append(dates, today)
 			continue
 		}
 		if p == "tomorrow" {
-			dates = append(dates, time.Now().AddDate(0, 0, 1))
+			dates = append(dates, today.AddDate(0, 0, 1))
 			continue
 		}
 
@@ -26,13 +81,12 @@ func ParseDates(input string) ([]time.Time, error) {
 
 		success := false
 		for _, f := range formats {
-			parsed, err = time.Parse(f, p)
+			parsed, err = time.ParseInLocation(f, p, time.Local)
 			if err == nil {
 				if f == "02.01" {
-					now := time.Now()
-					parsed = parsed.AddDate(now.Year(), 0, 0)
+					parsed = parsed.AddDate(today.Year(), 0, 0)
 
-					if parsed.Before(now.AddDate(0, 0, -2)) {
+					if parsed.Before(today.AddDate(0, 0, -2)) {
 						parsed = parsed.AddDate(1, 0, 0)
 					}
 				}
@@ -48,27 +102,113 @@ func ParseDates(input string) ([]time.Time, error) {
 	return dates, nil
 }
 
-func GetCountryCodeByName(name string) string {
-	m := map[string]string{
-		"germany": "DE", "deutschland": "DE",
-		"czech": "CZ", "czech republic": "CZ", "czechia": "CZ",
-		"austria": "AT", "france": "FR", "poland": "PL",
-		"slovakia": "SK", "hungary": "HU", "italy": "IT",
-		"netherlands": "NL", "croatia": "HR",
+// TimeWindow is a span of clock time on one weekday, e.g. "fri 16:00-23:59".
+type TimeWindow struct {
+	Day  time.Weekday
+	From int // minutes after midnight
+	To   int
+}
+
+// ParseTimeWindows reads a comma separated list such as
+// "fri 16:00-23:59,sat 06:00-12:00".
+func ParseTimeWindows(input string) ([]TimeWindow, error) {
+	var windows []TimeWindow
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		dayStr, span, ok := strings.Cut(part, " ")
+		day, known := weekdays[strings.ToLower(dayStr)]
+		fromStr, toStr, isSpan := strings.Cut(strings.TrimSpace(span), "-")
+		from, err1 := parseClock(fromStr)
+		to, err2 := parseClock(toStr)
+		if !ok || !known || !isSpan || err1 != nil || err2 != nil || to < from {
+			return nil, fmt.Errorf("invalid time window %q, expected e.g. \"fri 16:00-23:59\"", part)
+		}
+		windows = append(windows, TimeWindow{Day: day, From: from, To: to})
+	}
+	return windows, nil
+}
+
+// ParseWeekdayClock reads a weekday and time of day such as "sun 23:59" and
+// returns the minutes after midnight.
+func ParseWeekdayClock(input string) (time.Weekday, int, error) {
+	dayStr, clock, ok := strings.Cut(strings.TrimSpace(input), " ")
+	day, known := weekdays[strings.ToLower(dayStr)]
+	m, err := parseClock(clock)
+	if !ok || !known || err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expected e.g. \"sun 23:59\"", input)
 	}
-	return m[strings.ToLower(name)]
+	return day, m, nil
 }
 
-func GetCountryNamesByCode(code string) []string {
-	code = strings.ToUpper(code)
-	m := map[string]string{
-		"DE": "Germany", "CZ": "Czech Republic",
-		"AT": "Austria", "FR": "France", "PL": "Poland",
-		"SK": "Slovakia", "HU": "Hungary", "IT": "Italy",
-		"NL": "Netherlands", "HR": "Croatia",
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
 	}
-	if name, ok := m[code]; ok {
-		return []string{name}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t, read on its own clock, falls in the window.
+func (w TimeWindow) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	return t.Weekday() == w.Day && m >= w.From && m <= w.To
+}
+
+// InWindows reports whether t falls in any of the windows.
+func InWindows(t time.Time, windows []TimeWindow) bool {
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePassengers reads a party such as "2a,1c:8,1s,1st": a count followed by
+// a (adult), c (child), s (senior) or st (student), with an optional age
+// after a colon. Children need an age.
+func ParsePassengers(input string) ([]models.Passenger, error) {
+	var party []models.Passenger
+	for _, part := range strings.Split(input, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		spec, ageStr, hasAge := strings.Cut(part, ":")
+		i := 0
+		for i < len(spec) && spec[i] >= '0' && spec[i] <= '9' {
+			i++
+		}
+		count := 1
+		var err error
+		if i > 0 {
+			count, err = strconv.Atoi(spec[:i])
+		}
+		typ, ok := passengerTypes[spec[i:]]
+		if err != nil || !ok || count < 1 {
+			return nil, fmt.Errorf("invalid passengers %q, expected e.g. \"2a,1c:8,1s,1st\"", part)
+		}
+		// Checked before the party grows, so a huge count fails right away.
+		if len(party)+count > maxPassengers {
+			return nil, fmt.Errorf("at most %d passengers can travel together", maxPassengers)
+		}
+		age, known := passengerAges[typ]
+		if hasAge {
+			n, err := strconv.Atoi(ageStr)
+			if err != nil || n < 0 || n > 120 {
+				return nil, fmt.Errorf("invalid age in %q", part)
+			}
+			age, known = n, true
+		}
+		if !known {
+			return nil, fmt.Errorf("child needs an age, e.g. 1c:8")
+		}
+		for range count {
+			party = append(party, models.Passenger{Type: typ, Age: age})
+		}
 	}
-	return []string{}
+	return party, nil
 }
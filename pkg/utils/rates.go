@@ -0,0 +1,100 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+//go:embed data/rates.json
+var ratesJSON []byte
+
+// RateTable holds exchange rates against Base on one Date. The bundled table
+// can be replaced with a file in the same format.
+type RateTable struct {
+	Date   string             `json:"date"`
+	Base   string             `json:"base"`
+	Rates  map[string]float64 `json:"rates"`
+	Source string             `json:"-"`
+}
+
+var (
+	ratesMu sync.Mutex
+	rates   *RateTable
+)
+
+func parseRates(data []byte, source string) (*RateTable, error) {
+	var t RateTable
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	if t.Base == "" || t.Date == "" || len(t.Rates) == 0 {
+		return nil, fmt.Errorf("rate table needs date, base and rates")
+	}
+	t.Base = strings.ToUpper(t.Base)
+	upper := make(map[string]float64, len(t.Rates)+1)
+	for code, r := range t.Rates {
+		if r <= 0 {
+			return nil, fmt.Errorf("invalid rate %v for %s", r, code)
+		}
+		upper[strings.ToUpper(code)] = r
+	}
+	upper[t.Base] = 1
+	t.Rates = upper
+	t.Source = source
+	return &t, nil
+}
+
+// ReadRates reads and checks a rate table file without using it.
+func ReadRates(path string) (*RateTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseRates(data, path)
+}
+
+// LoadRates replaces the rate table with the one in path.
+func LoadRates(path string) error {
+	t, err := ReadRates(path)
+	if err != nil {
+		return err
+	}
+	ratesMu.Lock()
+	rates = t
+	ratesMu.Unlock()
+	return nil
+}
+
+// Rates returns the rate table in use, the bundled one unless LoadRates
+// replaced it.
+func Rates() *RateTable {
+	ratesMu.Lock()
+	defer ratesMu.Unlock()
+	if rates == nil {
+		t, err := parseRates(ratesJSON, "built-in")
+		if err != nil {
+			panic(fmt.Sprintf("utils: bad embedded rates.json: %v", err))
+		}
+		rates = t
+	}
+	return rates
+}
+
+// Convert converts an amount between two currencies through the base.
+func Convert(amount float64, from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return amount, nil
+	}
+	t := Rates()
+	rf, ok1 := t.Rates[from]
+	rt, ok2 := t.Rates[to]
+	if !ok1 || !ok2 {
+		return 0, fmt.Errorf("no exchange rate for %s to %s", from, to)
+	}
+	return amount / rf * rt, nil
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Letters folded to their ASCII base so that "Plzeň", "Plzen" and "PLZEN"
+// normalize alike. Covers Latin-1 and Latin Extended-A, which is every
+// alphabet our providers use for place names.
+var diacriticFold = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g",
+	'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĵ': "j", 'ķ': "k",
+	'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o",
+	'ŕ': "r", 'ŗ': "r", 'ř': "r",
+	'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ș': "s",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'ț': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w", 'ý': "y", 'ÿ': "y", 'ŷ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'þ': "th",
+}
+
+// FuzzyMinScore is the lowest MatchScore still worth offering as a candidate.
+const FuzzyMinScore = 0.55
+
+func NormalizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(name) {
+		if folded, ok := diacriticFold[r]; ok {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(folded)
+			space = false
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		} else if !unicode.Is(unicode.Mn, r) {
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// MatchScore rates how well a location name matches a user query, from 0 (no
+// match) to 1 (same normalized name).
+func MatchScore(query, name string) float64 {
+	return MatchNormalized(NormalizeName(query), NormalizeName(name))
+}
+
+// MatchNormalized is MatchScore for names already passed through
+// NormalizeName. Exact, word-prefix, prefix and substring matches score
+// highest; small typos still score above FuzzyMinScore.
+func MatchNormalized(q, n string) float64 {
+	switch {
+	case q == "" || n == "":
+		return 0
+	case q == n:
+		return 1
+	case strings.HasPrefix(n, q+" "):
+		return 0.9
+	case strings.HasPrefix(n, q):
+		return 0.8
+	case strings.Contains(n, q):
+		return 0.6
+	}
+
+	rq, rn := []rune(q), []rune(n)
+	maxDist := min(len(rq)/4, 2)
+	if maxDist == 0 {
+		return 0
+	}
+	dist := Levenshtein(q, n)
+	// A typo near the start of a longer name ("Ceksé Bud" for České Budějovice).
+	if len(rn) > len(rq) {
+		if d := Levenshtein(q, string(rn[:len(rq)])); d < dist {
+			dist = d
+		}
+	}
+	if dist > maxDist {
+		return 0
+	}
+	return 0.7 - 0.05*float64(dist)
+}
+
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"sync"
+	"time"
+	_ "time/tzdata"
+)
+
+// Time zone of every European country, by ISO alpha-2 code. Overseas parts
+// such as the Canary Islands or the Azores are not told apart.
+var countryTimeZones = map[string]string{
+	"AD": "Europe/Andorra", "AL": "Europe/Tirane", "AT": "Europe/Vienna",
+	"BA": "Europe/Sarajevo", "BE": "Europe/Brussels", "BG": "Europe/Sofia",
+	"BY": "Europe/Minsk", "CH": "Europe/Zurich", "CY": "Asia/Nicosia",
+	"CZ": "Europe/Prague", "DE": "Europe/Berlin", "DK": "Europe/Copenhagen",
+	"EE": "Europe/Tallinn", "ES": "Europe/Madrid", "FI": "Europe/Helsinki",
+	"FR": "Europe/Paris", "GB": "Europe/London", "GE": "Asia/Tbilisi",
+	"GR": "Europe/Athens", "HR": "Europe/Zagreb", "HU": "Europe/Budapest",
+	"IE": "Europe/Dublin", "IS": "Atlantic/Reykjavik", "IT": "Europe/Rome",
+	"LI": "Europe/Vaduz", "LT": "Europe/Vilnius", "LU": "Europe/Luxembourg",
+	"LV": "Europe/Riga", "MC": "Europe/Monaco", "MD": "Europe/Chisinau",
+	"ME": "Europe/Podgorica", "MK": "Europe/Skopje", "MT": "Europe/Malta",
+	"NL": "Europe/Amsterdam", "NO": "Europe/Oslo", "PL": "Europe/Warsaw",
+	"PT": "Europe/Lisbon", "RO": "Europe/Bucharest", "RS": "Europe/Belgrade",
+	"RU": "Europe/Moscow", "SE": "Europe/Stockholm", "SI": "Europe/Ljubljana",
+	"SK": "Europe/Bratislava", "SM": "Europe/San_Marino", "TR": "Europe/Istanbul",
+	"UA": "Europe/Kyiv", "VA": "Europe/Vatican", "XK": "Europe/Belgrade",
+}
+
+var (
+	zoneCache   = make(map[string]*time.Location)
+	zoneCacheMu sync.Mutex
+)
+
+// TimeZoneAt returns the time zone of a place, from its country or, when
+// that is unknown, from its coordinates. It returns nil when neither helps.
+func TimeZoneAt(country string, lat, lon float64) *time.Location {
+	if country == "" && (lat != 0 || lon != 0) {
+		country = CountryAt(lat, lon)
+	}
+	name, ok := countryTimeZones[country]
+	if !ok {
+		return nil
+	}
+
+	zoneCacheMu.Lock()
+	defer zoneCacheMu.Unlock()
+	if loc, ok := zoneCache[name]; ok {
+		return loc
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		DebugLog("Time zone %s: %v", name, err)
+		loc = nil
+	}
+	zoneCache[name] = loc
+	return loc
+}